@@ -0,0 +1,176 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/timo972/altv-cli/pkg/cache"
+	"github.com/timo972/altv-cli/pkg/logging"
+	"github.com/timo972/altv-cli/pkg/platform"
+	"github.com/timo972/altv-cli/pkg/vcs"
+	"github.com/timo972/altv-cli/pkg/version"
+)
+
+var bundleFile string
+var bundleBranches []string
+var bundleArches []string
+
+var bundleCmd = &cobra.Command{
+	Use:   "bundle",
+	Short: "Move server builds into air-gapped networks",
+	Long: `Export manifests and files of modules into a single archive and import it into the download cache of another host,
+so the modules can be installed there with --offline.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Usage()
+	},
+}
+
+var bundleExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export modules into a bundle",
+	Run: func(cmd *cobra.Command, args []string) {
+		logging.SetDebug(debug)
+		if silent {
+			logging.Disable()
+		}
+
+		branches := make([]version.Branch, len(bundleBranches))
+		for i, b := range bundleBranches {
+			branches[i] = version.Branch(b)
+		}
+		arches := make([]platform.Arch, len(bundleArches))
+		for i, a := range bundleArches {
+			arches[i] = platform.Arch(a)
+		}
+
+		setupCDNs()
+		startProgress()
+
+		ctx, cancel := timeoutContext(cmd.Context())
+		defer cancel()
+
+		// write next to the bundle and rename it into place, so a failed export never leaves a truncated bundle behind
+		f, err := os.CreateTemp(filepath.Dir(bundleFile), filepath.Base(bundleFile)+".*")
+		if err != nil {
+			stopProgress()
+			logging.ErrLogger.Fatalln(err)
+		}
+		defer os.Remove(f.Name())
+
+		index, err := vcs.ExportBundle(ctx, f, branches, arches, modules, vcs.DefaultRegistry, vcsOptions()...)
+		stopProgress()
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Rename(f.Name(), bundleFile)
+		}
+		if err != nil {
+			os.Remove(f.Name())
+			exit(nil, err)
+		}
+
+		if structuredOutput() {
+			printOutput(newBundleOutput(bundleFile, index))
+			return
+		}
+		printBundle(index)
+		logging.InfoLogger.Printf("exported %d modules to %s", len(index.Modules), bundleFile)
+	},
+}
+
+var bundleImportCmd = &cobra.Command{
+	Use:   "import <bundle.tar>",
+	Short: "Import a bundle into the download cache",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		logging.SetDebug(debug)
+		if silent {
+			logging.Disable()
+		}
+
+		if cacheDir == "" {
+			logging.ErrLogger.Fatalln("no cache directory, set one with --cache-dir")
+		}
+
+		f, err := os.Open(args[0])
+		if err != nil {
+			logging.ErrLogger.Fatalln(err)
+		}
+		defer f.Close()
+
+		index, err := vcs.ImportBundle(f, cache.New(cacheDir))
+		if err != nil {
+			exit(nil, err)
+		}
+
+		if structuredOutput() {
+			printOutput(newBundleOutput(args[0], index))
+			return
+		}
+		printBundle(index)
+		logging.InfoLogger.Printf("imported %d modules into %s, install them with --offline", len(index.Modules), cacheDir)
+	},
+}
+
+func init() {
+	bundleExportCmd.Flags().StringVarP(&bundleFile, "output-file", "o", "altv-bundle.tar", "file the bundle is written to")
+	bundleExportCmd.Flags().StringArrayVarP(&bundleBranches, "branch", "b", []string{"release"}, "server version branches to export")
+	bundleExportCmd.Flags().StringArrayVarP(&bundleArches, "arch", "a", []string{platform.Platform().String()}, "server binary architectures to export")
+	bundleExportCmd.Flags().StringArrayVarP(&modules, "modules", "m", []string{"server"}, "server components to export")
+	setDownloadFlags(bundleExportCmd)
+	setLogFlags(bundleExportCmd)
+	bundleCmd.AddCommand(bundleExportCmd)
+
+	setCacheFlag(bundleImportCmd)
+	setLogFlags(bundleImportCmd)
+	bundleCmd.AddCommand(bundleImportCmd)
+
+	rootCmd.AddCommand(bundleCmd)
+}
+
+type bundleModuleOutput struct {
+	Module  string `json:"module" yaml:"module"`
+	Branch  string `json:"branch" yaml:"branch"`
+	Arch    string `json:"arch" yaml:"arch"`
+	Version string `json:"version" yaml:"version"`
+	Files   int    `json:"files" yaml:"files"`
+	Size    int64  `json:"size" yaml:"size"`
+}
+
+type bundleOutput struct {
+	File    string                `json:"file" yaml:"file"`
+	Created string                `json:"created" yaml:"created"`
+	Modules []*bundleModuleOutput `json:"modules" yaml:"modules"`
+}
+
+func newBundleOutput(file string, index *vcs.BundleIndex) *bundleOutput {
+	out := &bundleOutput{
+		File:    file,
+		Created: index.Created.Format(time.RFC3339),
+		Modules: make([]*bundleModuleOutput, len(index.Modules)),
+	}
+	for i, mod := range index.Modules {
+		var size int64
+		for _, file := range mod.Files {
+			size += int64(file.Size)
+		}
+		out.Modules[i] = &bundleModuleOutput{
+			Module:  mod.Module,
+			Branch:  mod.Branch.String(),
+			Arch:    mod.Arch.String(),
+			Version: mod.Manifest.Version,
+			Files:   len(mod.Files),
+			Size:    size,
+		}
+	}
+	return out
+}
+
+func printBundle(index *vcs.BundleIndex) {
+	for _, mod := range newBundleOutput("", index).Modules {
+		logging.InfoLogger.Printf("%-18s %s %s/%s, %d files, %s", mod.Module, mod.Version, mod.Branch, mod.Arch, mod.Files, formatBytes(mod.Size))
+	}
+}
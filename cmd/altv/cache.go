@@ -0,0 +1,112 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/timo972/altv-cli/pkg/cache"
+	"github.com/timo972/altv-cli/pkg/logging"
+)
+
+var maxCacheSize string
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the download cache",
+	Long: `List, measure or shrink the download cache shared by all installations.
+Downloaded files are kept by their hash, so installing the same version into another directory does not download them again.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Usage()
+	},
+}
+
+var cacheListCmd = &cobra.Command{
+	Use:     "ls",
+	Short:   "List cached files",
+	Aliases: []string{"list"},
+	Run: func(cmd *cobra.Command, args []string) {
+		c := openCache()
+
+		entries, err := c.List()
+		if err != nil {
+			logging.ErrLogger.Fatalln(err)
+		}
+
+		if structuredOutput() {
+			printOutput(entries)
+			return
+		}
+
+		if len(entries) == 0 {
+			logging.InfoLogger.Printf("cache %s is empty", c.Dir())
+			return
+		}
+
+		for _, entry := range entries {
+			logging.InfoLogger.Printf("%s  %10s  %s", entry.Hash, formatBytes(entry.Size), entry.Used.Format("2006-01-02 15:04:05"))
+		}
+	},
+}
+
+var cacheSizeCmd = &cobra.Command{
+	Use:   "size",
+	Short: "Print the size of the cache",
+	Run: func(cmd *cobra.Command, args []string) {
+		c := openCache()
+
+		size, err := c.Size()
+		if err != nil {
+			logging.ErrLogger.Fatalln(err)
+		}
+
+		if structuredOutput() {
+			printOutput(map[string]any{"dir": c.Dir(), "size": size})
+			return
+		}
+		logging.InfoLogger.Printf("cache %s holds %s", c.Dir(), formatBytes(size))
+	},
+}
+
+var cacheGCCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Delete the least recently used cached files",
+	Run: func(cmd *cobra.Command, args []string) {
+		maxSize, err := parseSize(maxCacheSize)
+		if err != nil {
+			logging.ErrLogger.Fatalf("invalid --max-size: %v", err)
+		}
+
+		deleted, err := openCache().GC(maxSize)
+		if err != nil {
+			logging.ErrLogger.Fatalln(err)
+		}
+
+		var freed int64
+		for _, entry := range deleted {
+			logging.DebugLogger.Printf("deleted %s", entry.Hash)
+			freed += entry.Size
+		}
+		logging.InfoLogger.Printf("deleted %d cached files, freed %s", len(deleted), formatBytes(freed))
+	},
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{cacheListCmd, cacheSizeCmd, cacheGCCmd} {
+		setCacheFlag(cmd)
+		setLogFlags(cmd)
+		cacheCmd.AddCommand(cmd)
+	}
+	cacheGCCmd.Flags().StringVar(&maxCacheSize, "max-size", "0", "size the cache is shrunk to, e.g. 500M or 10G (binary units, 0 = delete everything)")
+	rootCmd.AddCommand(cacheCmd)
+}
+
+// openCache sets up logging and returns the cache selected by --cache-dir.
+func openCache() cache.Cache {
+	logging.SetDebug(debug)
+	if silent {
+		logging.Disable()
+	}
+
+	if cacheDir == "" {
+		logging.ErrLogger.Fatalln("no cache directory, set one with --cache-dir")
+	}
+	return cache.New(cacheDir)
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/timo972/altv-cli/pkg/auth"
+	"github.com/timo972/altv-cli/pkg/cdn"
+	"github.com/timo972/altv-cli/pkg/cdn/altcdn"
+	"github.com/timo972/altv-cli/pkg/cdn/ghcdn"
+	"gopkg.in/yaml.v3"
+)
+
+// configFile is the path of the config file, the default one may be missing.
+var configFile string
+
+// cfg holds the settings read from the config file, flags take precedence over it.
+var cfg config
+
+// credentialsFile is the path of the credentials file, the default one may be missing.
+var credentialsFile string
+
+// credentials holds the credentials per cdn name of the config and the credentials file, the latter take precedence.
+var credentials = make(map[string]*auth.Credentials)
+
+type config struct {
+	// LimitRate limits the combined throughput of all downloads, e.g. 5M.
+	LimitRate string `yaml:"limitRate"`
+	// HTTP configures the http client shared by all cdns.
+	HTTP httpConfig `yaml:"http"`
+	// CDNs holds settings per cdn, keyed by the cdn name, e.g. https://cdn.alt-mp.com, github or the base url of a mirror.
+	CDNs map[string]*cdnConfig `yaml:"cdns"`
+}
+
+type httpConfig struct {
+	CAFile         string        `yaml:"caFile"`
+	ClientCert     string        `yaml:"clientCert"`
+	ClientKey      string        `yaml:"clientKey"`
+	Proxy          string        `yaml:"proxy"`
+	UserAgent      string        `yaml:"userAgent"`
+	ConnectTimeout time.Duration `yaml:"connectTimeout"`
+	IdleTimeout    time.Duration `yaml:"idleTimeout"`
+}
+
+type cdnConfig struct {
+	// Modules registers the cdn as mirror of the alt:V cdn for these modules, its name is the base url it is reached at.
+	// A mirror is laid out like the alt:V cdn and takes precedence over it.
+	Modules []string `yaml:"modules"`
+	// LimitRate limits the combined throughput of all downloads from the cdn.
+	LimitRate string `yaml:"limitRate"`
+	// Auth authenticates the requests to the cdn, $VAR and ${VAR} are replaced by environment variables.
+	Auth *auth.Credentials `yaml:"auth"`
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", defaultConfigFile(), "config file with settings per cdn")
+	rootCmd.PersistentFlags().StringVar(&credentialsFile, "credentials-file", defaultCredentialsFile(), "file with credentials per cdn, must not be readable by other users")
+}
+
+// defaultConfigFile returns config.yaml in the user config directory, e.g. ~/.config/altv/config.yaml on linux.
+func defaultConfigFile() string {
+	return userConfigFile("config.yaml")
+}
+
+// defaultCredentialsFile returns credentials.yaml in the user config directory, e.g. ~/.config/altv/credentials.yaml on linux.
+func defaultCredentialsFile() string {
+	return userConfigFile("credentials.yaml")
+}
+
+func userConfigFile(name string) string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "altv", name)
+}
+
+// setupConfig reads the config and credentials file, only files passed explicitly have to exist, and validates the flags overriding them.
+func setupConfig() error {
+	if _, err := parseRate(limitRate); err != nil {
+		return fmt.Errorf("invalid --limit-rate: %w", err)
+	}
+
+	if err := readConfig(); err != nil {
+		return err
+	}
+	return readCredentials()
+}
+
+func readConfig() error {
+	if configFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(configFile)
+	if errors.Is(err, fs.ErrNotExist) && configFile == defaultConfigFile() {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("unable to read config file: %w", err)
+	}
+
+	if err = yaml.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", configFile, err)
+	}
+
+	// files in the config file are relative to it
+	for _, name := range []*string{&cfg.HTTP.CAFile, &cfg.HTTP.ClientCert, &cfg.HTTP.ClientKey} {
+		if *name != "" && !filepath.IsAbs(*name) {
+			*name = filepath.Join(filepath.Dir(configFile), *name)
+		}
+	}
+
+	if _, err = parseRate(cfg.LimitRate); err != nil {
+		return fmt.Errorf("invalid limitRate in %s: %w", configFile, err)
+	}
+	for name, c := range cfg.CDNs {
+		if c == nil {
+			continue
+		}
+		if len(c.Modules) > 0 {
+			if err = validateMirror(name, c.Modules); err != nil {
+				return fmt.Errorf("invalid mirror %s in %s: %w", name, configFile, err)
+			}
+		} else if !knownCDN(name) {
+			return fmt.Errorf("unknown cdn %s in %s, expected %s, %s or a mirror with modules", name, configFile, altcdn.Default.Name(), ghcdn.Name)
+		}
+		if _, err = parseRate(c.LimitRate); err != nil {
+			return fmt.Errorf("invalid limitRate of cdn %s in %s: %w", name, configFile, err)
+		}
+
+		if c.Auth == nil {
+			continue
+		}
+		creds := expandCredentials(c.Auth)
+		if err = creds.Validate(); err != nil {
+			return fmt.Errorf("invalid auth of cdn %s in %s: %w", name, configFile, err)
+		}
+		credentials[name] = creds
+	}
+	return nil
+}
+
+// validateMirror checks that the mirror is reached by an http(s) base url and mirrors known modules of the alt:V cdn.
+func validateMirror(name string, modules []string) error {
+	u, err := url.Parse(name)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("expected an http or https base url")
+	}
+	if strings.HasSuffix(u.Path, "/") || u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("base url must not end with a slash or have a query")
+	}
+	if name == altcdn.Default.Name() {
+		return fmt.Errorf("the alt:V cdn can not mirror itself")
+	}
+
+	for _, mod := range modules {
+		if _, ok := altcdn.DefaultModules[mod]; !ok {
+			return fmt.Errorf("unknown module %s, only modules of the alt:V cdn can be mirrored", mod)
+		}
+	}
+	return nil
+}
+
+// knownCDN reports whether a cdn with the name exists, github counts even if --github is not set.
+func knownCDN(name string) bool {
+	if name == altcdn.Default.Name() || name == ghcdn.Name {
+		return true
+	}
+	c, ok := cfg.CDNs[name]
+	return ok && c != nil && len(c.Modules) > 0
+}
+
+// mirrorCDNs returns the mirrors of the config file, sorted by name so they are registered in a stable order.
+func mirrorCDNs() []cdn.CDN {
+	names := make([]string, 0, len(cfg.CDNs))
+	for name, c := range cfg.CDNs {
+		if c != nil && len(c.Modules) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	cdns := make([]cdn.CDN, len(names))
+	for i, name := range names {
+		modules := make(altcdn.ModuleMap, len(cfg.CDNs[name].Modules))
+		for _, mod := range cfg.CDNs[name].Modules {
+			modules[mod] = altcdn.DefaultModules[mod]
+		}
+		cdns[i] = altcdn.New(name, modules)
+	}
+	return cdns
+}
+
+// expandCredentials replaces environment variables in the credentials, so secrets can be kept out of the config file.
+func expandCredentials(c *auth.Credentials) *auth.Credentials {
+	return &auth.Credentials{
+		Token:    os.ExpandEnv(c.Token),
+		Username: os.ExpandEnv(c.Username),
+		Password: os.ExpandEnv(c.Password),
+		Header:   os.ExpandEnv(c.Header),
+		Value:    os.ExpandEnv(c.Value),
+	}
+}
+
+func readCredentials() error {
+	if credentialsFile == "" {
+		return nil
+	}
+
+	creds, err := auth.ReadFile(credentialsFile)
+	if errors.Is(err, fs.ErrNotExist) && credentialsFile == defaultCredentialsFile() {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("unable to read credentials: %w", err)
+	}
+
+	for name, c := range creds {
+		if !knownCDN(name) {
+			return fmt.Errorf("credentials for unknown cdn %s in %s, expected %s, %s or a mirror of the config file", name, credentialsFile, altcdn.Default.Name(), ghcdn.Name)
+		}
+		credentials[name] = c
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+
+	"github.com/timo972/altv-cli/pkg/logging"
+	"github.com/timo972/altv-cli/pkg/vcs"
+)
+
+// exit codes of install, update, verify and rollback, keep in sync with the README.
+const (
+	exitOK = iota
+	// exitError is any error that is not covered by a more specific exit code.
+	exitError
+	// exitCorrupted is returned if files of at least one module are missing or corrupted.
+	exitCorrupted
+	// exitUpgradable is returned by verify --fail-on-upgradable if a newer version of at least one module is available.
+	exitUpgradable
+	// exitUnreachable is returned if the manifest of at least one module could not be fetched from its cdn, or files are missing offline.
+	exitUnreachable
+	// exitPartial is returned if the command succeeded for some modules but failed for others.
+	exitPartial
+)
+
+var failOnUpgradable bool
+
+// exitCode maps the module status and error of a command to its exit code.
+// Corrupted files take precedence over partial failures, which take precedence over cdn errors.
+// A cdn error of some modules is a partial failure, only a cdn error of every module exits with exitUnreachable.
+func exitCode(status vcs.ModuleStatusResult, err error) int {
+	switch {
+	case len(status.Invalid()) > 0:
+		return exitCorrupted
+	case err == nil:
+	case vcs.IsPartial(err):
+		return exitPartial
+	case vcs.IsUnreachable(err):
+		return exitUnreachable
+	default:
+		return exitError
+	}
+
+	if failOnUpgradable && len(status.Upgradable()) > 0 {
+		return exitUpgradable
+	}
+	return exitOK
+}
+
+// exit logs the error, if any, and terminates with the exit code of the command result.
+func exit(status vcs.ModuleStatusResult, err error) {
+	if err != nil {
+		logging.ErrLogger.Println(err)
+	}
+	if code := exitCode(status, err); code != exitOK {
+		os.Exit(code)
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"github.com/timo972/altv-cli/pkg/version"
 )
 
+var frozen bool
+
 var installCmd = &cobra.Command{
 	Use:     "install",
 	Short:   "Install alt:V server",
@@ -21,15 +23,22 @@ var installCmd = &cobra.Command{
 
 		logging.InfoLogger.Println("alt:V server installer")
 
-		experimentalGithubCDN()
-		inst := vcs.NewDownloader(platform.Arch(arch), version.Branch(branch), modules, vcs.DefaultRegistry)
+		setupCDNs()
+		startProgress()
+		inst := vcs.NewDownloader(platform.Arch(arch), version.Branch(branch), modules, vcs.DefaultRegistry, vcsOptions()...)
 
 		ctx, cancel := timeoutContext(cmd.Context())
 		defer cancel()
 
-		if err := inst.Download(ctx, path, manifests); err != nil {
-			logging.ErrLogger.Fatalln(err)
+		result, err := inst.Download(ctx, path, vcs.DownloadOptions{
+			Manifests: manifests,
+			Frozen:    frozen,
+		})
+		stopProgress()
+		if structuredOutput() {
+			printOutput(newTransferOutput(result, err))
 		}
+		exit(nil, err)
 
 		logging.InfoLogger.Println("successfully installed")
 	},
@@ -37,5 +46,6 @@ var installCmd = &cobra.Command{
 
 func init() {
 	setFlags(installCmd)
+	installCmd.Flags().BoolVar(&frozen, "frozen", false, "refuse to install if a remote manifest differs from "+vcs.LockfileName)
 	rootCmd.AddCommand(installCmd)
 }
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/timo972/altv-cli/pkg/logging"
+	"github.com/timo972/altv-cli/pkg/vcs"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+var output string
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&output, "output", outputTable, "output format: table, json or yaml (logs are written to stderr for json and yaml)")
+}
+
+// setupOutput validates the output format and moves all logs to stderr for structured output, so stdout only holds the document.
+func setupOutput() error {
+	switch output {
+	case outputTable:
+	case outputJSON, outputYAML:
+		logging.SetOutput(os.Stderr)
+	default:
+		return fmt.Errorf("unknown output format %q, expected table, json or yaml", output)
+	}
+	return nil
+}
+
+// structuredOutput reports whether results are printed as json or yaml document instead of log lines.
+func structuredOutput() bool {
+	return output == outputJSON || output == outputYAML
+}
+
+// printOutput writes the document to stdout in the selected output format.
+func printOutput(v any) {
+	var err error
+	switch output {
+	case outputJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(v)
+	case outputYAML:
+		enc := yaml.NewEncoder(os.Stdout)
+		enc.SetIndent(2)
+		if err = enc.Encode(v); err == nil {
+			err = enc.Close()
+		}
+	}
+	if err != nil {
+		logging.ErrLogger.Fatalf("unable to write %s output: %v", output, err)
+	}
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+type fileOutput struct {
+	Name   string `json:"name" yaml:"name"`
+	Size   int    `json:"size" yaml:"size"`
+	Change string `json:"change" yaml:"change"`
+	Error  string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+type moduleTransferOutput struct {
+	Module      string        `json:"module" yaml:"module"`
+	FromVersion string        `json:"fromVersion,omitempty" yaml:"fromVersion,omitempty"`
+	ToVersion   string        `json:"toVersion" yaml:"toVersion"`
+	Downloaded  []*fileOutput `json:"downloaded" yaml:"downloaded"`
+	Skipped     []*fileOutput `json:"skipped" yaml:"skipped"`
+	Failed      []*fileOutput `json:"failed" yaml:"failed"`
+	// Pending files were not downloaded, because of a dry run or an aborted download.
+	Pending []*fileOutput `json:"pending,omitempty" yaml:"pending,omitempty"`
+	Removed []*fileOutput `json:"removed,omitempty" yaml:"removed,omitempty"`
+}
+
+type transferOutput struct {
+	Modules []*moduleTransferOutput `json:"modules" yaml:"modules"`
+	Error   string                  `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+func newTransferModules(result vcs.UpdateResult) []*moduleTransferOutput {
+	mods := make([]*moduleTransferOutput, len(result))
+	for i, upd := range result {
+		mod := &moduleTransferOutput{
+			Module:      upd.Module,
+			FromVersion: upd.FromVersion,
+			ToVersion:   upd.ToVersion,
+			Downloaded:  []*fileOutput{},
+			Skipped:     []*fileOutput{},
+			Failed:      []*fileOutput{},
+		}
+		for _, file := range upd.Files {
+			out := &fileOutput{
+				Name:   file.Name,
+				Size:   file.Size,
+				Change: file.Change.String(),
+				Error:  errorString(file.Err),
+			}
+			switch {
+			case file.Change == vcs.FileRemoved:
+				mod.Removed = append(mod.Removed, out)
+			case file.State == vcs.TransferDownloaded:
+				mod.Downloaded = append(mod.Downloaded, out)
+			case file.State == vcs.TransferSkipped:
+				mod.Skipped = append(mod.Skipped, out)
+			case file.State == vcs.TransferFailed:
+				mod.Failed = append(mod.Failed, out)
+			default:
+				mod.Pending = append(mod.Pending, out)
+			}
+		}
+		mods[i] = mod
+	}
+	return mods
+}
+
+func newTransferOutput(result vcs.UpdateResult, err error) *transferOutput {
+	return &transferOutput{
+		Modules: newTransferModules(result),
+		Error:   errorString(err),
+	}
+}
+
+type fileReportOutput struct {
+	Name  string `json:"name" yaml:"name"`
+	State string `json:"state" yaml:"state"`
+	// Archive is the file this file was extracted from.
+	Archive string `json:"archive,omitempty" yaml:"archive,omitempty"`
+	Error   string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+type moduleReportOutput struct {
+	Module    string              `json:"module" yaml:"module"`
+	Version   string              `json:"version" yaml:"version"`
+	Integrity string              `json:"integrity" yaml:"integrity"`
+	Update    string              `json:"update" yaml:"update"`
+	Files     []*fileReportOutput `json:"files" yaml:"files"`
+}
+
+type reportOutput struct {
+	Modules []*moduleReportOutput `json:"modules" yaml:"modules"`
+	// Repaired holds the files re-downloaded by verify --repair.
+	Repaired []*moduleTransferOutput `json:"repaired,omitempty" yaml:"repaired,omitempty"`
+	// Snapshots holds the ids of the snapshots applied by rollback.
+	Snapshots []string `json:"snapshots,omitempty" yaml:"snapshots,omitempty"`
+	Error     string   `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+func newReportOutput(report vcs.Report, err error) *reportOutput {
+	out := &reportOutput{
+		Modules: make([]*moduleReportOutput, 0, len(report)),
+		Error:   errorString(err),
+	}
+	for _, mod := range report.Modules() {
+		mr := report[mod]
+		status := statusToText(mr.Status)
+		mout := &moduleReportOutput{
+			Module:    mod,
+			Version:   mr.Version,
+			Integrity: status[0],
+			Update:    status[1],
+			Files:     make([]*fileReportOutput, len(mr.Files)),
+		}
+		for i, file := range mr.Files {
+			mout.Files[i] = &fileReportOutput{
+				Name:    file.Name,
+				State:   file.State.String(),
+				Archive: file.Archive,
+				Error:   errorString(file.Err),
+			}
+		}
+		out.Modules = append(out.Modules, mout)
+	}
+	return out
+}
+
+func statusToText(status vcs.ModuleStatus) [2]string {
+	str := [2]string{"unknown", "unknown"}
+
+	if status.Has(vcs.StatusValid) {
+		str[0] = "valid"
+	} else if status.Has(vcs.StatusInvalid) {
+		str[0] = "invalid"
+	}
+
+	if status.Has(vcs.StatusUpToDate) {
+		str[1] = "up to date"
+	} else if status.Has(vcs.StatusUpgradable) {
+		str[1] = "upgradable"
+	}
+
+	return str
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/timo972/altv-cli/pkg/logging"
+	"github.com/timo972/altv-cli/pkg/vcs"
+)
+
+const progressBarWidth = 30
+
+// progress renders per module and overall progress bars of downloads and verifications to a terminal.
+// It doubles as log output, so log lines are printed above the bars instead of breaking them.
+type progress struct {
+	mu      sync.Mutex
+	out     io.Writer
+	modules []*moduleProgress
+	byName  map[string]*moduleProgress
+	// lines drawn by the last render, they are redrawn in place
+	lines    int
+	lastDone int64
+	lastTick time.Time
+	speed    float64
+	stop     chan struct{}
+	stopped  chan struct{}
+}
+
+type moduleProgress struct {
+	name     string
+	sizes    map[string]int64
+	files    map[string]int64
+	total    int64
+	done     int64
+	finished bool
+	failed   bool
+}
+
+// bar is the progress renderer of the running command, nil if progress is disabled.
+var bar *progress
+
+// isTerminal reports whether the file is a character device, e.g. a terminal and not a pipe or file.
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// startProgress renders progress bars while a command runs, unless logging is disabled, the output is structured or stdout is not a terminal.
+func startProgress() {
+	if silent || structuredOutput() || !isTerminal(os.Stdout) {
+		return
+	}
+
+	bar = &progress{
+		out:      os.Stdout,
+		byName:   make(map[string]*moduleProgress),
+		lastTick: time.Now(),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	logging.SetOutput(bar)
+	go bar.run()
+}
+
+// stopProgress renders the final state of the progress bars and restores the log output.
+func stopProgress() {
+	if bar == nil {
+		return
+	}
+
+	close(bar.stop)
+	<-bar.stopped
+	logging.SetOutput(os.Stdout)
+	bar = nil
+}
+
+func (p *progress) run() {
+	defer close(p.stopped)
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.mu.Lock()
+			p.render()
+			p.mu.Unlock()
+		case <-p.stop:
+			p.mu.Lock()
+			p.render()
+			p.mu.Unlock()
+			return
+		}
+	}
+}
+
+func (p *progress) module(name string) *moduleProgress {
+	mp, ok := p.byName[name]
+	if !ok {
+		mp = &moduleProgress{
+			name:  name,
+			sizes: make(map[string]int64),
+			files: make(map[string]int64),
+		}
+		p.byName[name] = mp
+		p.modules = append(p.modules, mp)
+	}
+	return mp
+}
+
+// set updates the processed bytes of the file.
+func (mp *moduleProgress) set(file string, n int64) {
+	mp.done += n - mp.files[file]
+	mp.files[file] = n
+}
+
+func (p *progress) Observe(e vcs.Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	mp := p.module(e.Module)
+	switch e.Type {
+	case vcs.EventFileQueued:
+		if _, ok := mp.sizes[e.File]; !ok {
+			mp.sizes[e.File] = max(e.Size, 0)
+			mp.total += max(e.Size, 0)
+		}
+	case vcs.EventFileProgress:
+		mp.set(e.File, e.Bytes)
+	case vcs.EventFileVerified:
+		mp.set(e.File, mp.sizes[e.File])
+	case vcs.EventFileFailed:
+		mp.failed = true
+		mp.set(e.File, mp.sizes[e.File])
+	case vcs.EventModuleDone:
+		mp.finished = true
+	}
+}
+
+// Write prints log lines above the progress bars.
+func (p *progress) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.clear()
+	n, err := p.out.Write(b)
+	p.lines = 0
+	p.render()
+	return n, err
+}
+
+// clear removes the progress bars drawn last, the caller has to hold the lock.
+func (p *progress) clear() {
+	if p.lines > 0 {
+		fmt.Fprintf(p.out, "\x1b[%dA\x1b[J", p.lines)
+	}
+}
+
+// render redraws the progress bars, the caller has to hold the lock.
+func (p *progress) render() {
+	if len(p.modules) == 0 {
+		return
+	}
+
+	var total, done int64
+	for _, mp := range p.modules {
+		total += mp.total
+		done += mp.done
+	}
+
+	now := time.Now()
+	if dt := now.Sub(p.lastTick).Seconds(); dt >= 0.1 {
+		// exponentially weighted moving average, so the speed does not jump with every tick
+		p.speed = 0.7*p.speed + 0.3*float64(done-p.lastDone)/dt
+		p.lastDone = done
+		p.lastTick = now
+	}
+
+	lines := make([]string, 0, len(p.modules)+1)
+	for _, mp := range p.modules {
+		state := ""
+		switch {
+		case mp.failed:
+			state = "failed"
+		case mp.finished:
+			state = "done"
+		}
+		lines = append(lines, fmt.Sprintf("%-18s %s %s", mp.name, progressBar(mp.done, mp.total), state))
+	}
+
+	eta := "--"
+	if p.speed > 0 && done < total {
+		eta = (time.Duration(float64(total-done)/p.speed) * time.Second).Round(time.Second).String()
+	}
+	lines = append(lines, fmt.Sprintf("%-18s %s %s/s ETA %s", "total", progressBar(done, total), formatBytes(int64(p.speed)), eta))
+
+	p.clear()
+	for _, line := range lines {
+		fmt.Fprintf(p.out, "\r\x1b[2K%s\n", line)
+	}
+	p.lines = len(lines)
+}
+
+func progressBar(done, total int64) string {
+	ratio := 1.0
+	if total > 0 {
+		ratio = min(float64(done)/float64(total), 1)
+	}
+	filled := int(ratio * progressBarWidth)
+	return fmt.Sprintf("[%s%s] %3d%% %9s / %-9s", strings.Repeat("#", filled), strings.Repeat("-", progressBarWidth-filled), int(ratio*100), formatBytes(done), formatBytes(total))
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
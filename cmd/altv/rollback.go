@@ -0,0 +1,45 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/timo972/altv-cli/pkg/logging"
+	"github.com/timo972/altv-cli/pkg/vcs"
+)
+
+var rollbackTo string
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback",
+	Short: "Roll back alt:V server update",
+	Long:  `Restore the alt:V server in a directory from the snapshot taken before the last update, or before the update away from the given version.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		logging.SetDebug(debug)
+		if silent {
+			logging.Disable()
+		}
+
+		logging.InfoLogger.Println("alt:V server rollback")
+
+		snaps, report, err := vcs.NewSnapshotStore(path).Rollback(rollbackTo)
+		for _, snap := range snaps {
+			logging.InfoLogger.Printf("rolled back snapshot %s", snap.ID)
+		}
+		if structuredOutput() {
+			out := newReportOutput(report, err)
+			for _, snap := range snaps {
+				out.Snapshots = append(out.Snapshots, snap.ID)
+			}
+			printOutput(out)
+		} else if report != nil {
+			printSummary(logging.InfoLogger, report, true)
+		}
+		exit(report.Status(), err)
+	},
+}
+
+func init() {
+	setPathFlag(rollbackCmd)
+	setLogFlags(rollbackCmd)
+	rollbackCmd.Flags().StringVar(&rollbackTo, "to", "", "snapshot id, module version or build number to roll back to")
+	rootCmd.AddCommand(rollbackCmd)
+}
@@ -11,6 +11,12 @@ var rootCmd = &cobra.Command{
 	Use:   "altv",
 	Short: "alt:V command line tool",
 	Long:  `A blazingly fast alt:V server manager cli written in go.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := setupOutput(); err != nil {
+			return err
+		}
+		return setupConfig()
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		cmd.Usage()
 	},
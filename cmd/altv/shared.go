@@ -2,12 +2,25 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/timo972/altv-cli/pkg/cache"
 	"github.com/timo972/altv-cli/pkg/cdn/ghcdn"
 	"github.com/timo972/altv-cli/pkg/cdn/ghcdn/gomodule"
 	"github.com/timo972/altv-cli/pkg/cdn/ghcdn/jsmodulev2"
+	"github.com/timo972/altv-cli/pkg/logging"
+	"github.com/timo972/altv-cli/pkg/mirror"
 	"github.com/timo972/altv-cli/pkg/platform"
+	"github.com/timo972/altv-cli/pkg/retry"
+	"github.com/timo972/altv-cli/pkg/transport"
 	"github.com/timo972/altv-cli/pkg/util"
 	"github.com/timo972/altv-cli/pkg/vcs"
 )
@@ -21,32 +34,253 @@ var debug bool
 var silent bool
 var manifests bool
 var github bool
+var concurrency int
+var hostConcurrency int
+var segments int
+var segmentThreshold int
+var retries int
+var retryDelay time.Duration
+var retryMaxDelay time.Duration
+var client *http.Client
+var cacheDir string
+var noCache bool
+var offline bool
+var mirrorDir string
+var limitRate string
+var caFile string
+var clientCert string
+var clientKey string
+var proxy string
+var userAgent string
+var connectTimeout time.Duration
+var idleTimeout time.Duration
 
 func setFlags(cmd *cobra.Command) {
 	cmd.Flags().StringVarP(&branch, "branch", "b", "release", "server version branch")
 	cmd.Flags().StringVarP(&arch, "arch", "a", platform.Platform().String(), "server binary architecture")
-	cmd.Flags().StringVarP(&path, "path", "p", ".", "server installation path")
 	cmd.Flags().StringArrayVarP(&modules, "modules", "m", []string{"server"}, "server components to install")
-	cmd.Flags().IntVarP(&timeout, "timeout", "t", -1, "server download timeout (in seconds)")
 	cmd.Flags().BoolVarP(&manifests, "manifests", "M", false, "download manifests for all modules, useful to verify server files later on")
-	cmd.Flags().BoolVarP(&github, "github", "g", false, "add experimental github cdn (required for js-module-v2 and go-module)")
+	setDownloadFlags(cmd)
+	setPathFlag(cmd)
 	setLogFlags(cmd)
 }
 
+// setDownloadFlags adds the flags tuning how manifests and files are fetched.
+func setDownloadFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVarP(&timeout, "timeout", "t", -1, "server download timeout (in seconds)")
+	cmd.Flags().BoolVarP(&github, "github", "g", false, "add experimental github cdn (required for js-module-v2 and go-module)")
+	cmd.Flags().IntVar(&concurrency, "concurrency", vcs.DefaultConcurrency, "maximum number of files downloaded at once (0 = unlimited)")
+	cmd.Flags().IntVar(&hostConcurrency, "host-concurrency", vcs.DefaultHostConcurrency, "maximum number of files downloaded at once from a single cdn host (0 = unlimited)")
+	cmd.Flags().IntVar(&segments, "segments", vcs.DefaultSegments, "maximum number of connections large files are downloaded with, they count towards --host-concurrency (1 = disabled)")
+	cmd.Flags().IntVar(&segmentThreshold, "segment-threshold", vcs.DefaultSegmentThreshold>>20, "size in MiB from which on files are downloaded in segments")
+	cmd.Flags().IntVar(&retries, "retries", retry.DefaultPolicy.Retries, "number of retries of failed cdn requests and interrupted downloads (0 = disabled)")
+	cmd.Flags().DurationVar(&retryDelay, "retry-delay", retry.DefaultPolicy.MinDelay, "delay before the first retry, doubled for every further retry")
+	cmd.Flags().DurationVar(&retryMaxDelay, "retry-max-delay", retry.DefaultPolicy.MaxDelay, "maximum delay between retries, also caps Retry-After")
+	cmd.Flags().BoolVar(&noCache, "no-cache", false, "do not restore files from or add files to the download cache")
+	cmd.Flags().BoolVar(&offline, "offline", false, "never touch the network, resolve manifests and files only from the download cache and --mirror")
+	cmd.Flags().StringVar(&mirrorDir, "mirror", "", "directory laid out like the cdn paths to resolve files from with --offline")
+	cmd.Flags().StringVar(&limitRate, "limit-rate", "", "limit the combined throughput of all downloads per second, e.g. 5M (binary units, overrides the config file)")
+	setHTTPFlags(cmd)
+	setCacheFlag(cmd)
+}
+
+// setHTTPFlags adds the flags configuring the http client shared by all cdns, they override the http section of the config file.
+func setHTTPFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&caFile, "ca-file", "", "PEM file with certificate authorities to trust in addition to the system ones")
+	cmd.Flags().StringVar(&clientCert, "client-cert", "", "PEM file with the client certificate for cdns requiring mutual TLS")
+	cmd.Flags().StringVar(&clientKey, "client-key", "", "PEM file with the key of --client-cert")
+	cmd.Flags().StringVar(&proxy, "proxy", "", "url of the proxy to send all requests through (default from HTTPS_PROXY and NO_PROXY)")
+	cmd.Flags().StringVar(&userAgent, "user-agent", "", "User-Agent header sent with every request (default \""+transport.DefaultUserAgent+"\")")
+	cmd.Flags().DurationVar(&connectTimeout, "connect-timeout", 0, "maximum time to establish a connection including the TLS handshake (0 = default)")
+	cmd.Flags().DurationVar(&idleTimeout, "idle-timeout", 0, "time after which idle connections are closed (0 = default)")
+}
+
+func setCacheFlag(cmd *cobra.Command) {
+	dir, err := cache.DefaultDir()
+	if err != nil {
+		dir = ""
+	}
+	cmd.Flags().StringVar(&cacheDir, "cache-dir", dir, "directory of the download cache shared by all installations")
+}
+
+func setPathFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&path, "path", "p", ".", "server installation path")
+}
+
 func setLogFlags(cmd *cobra.Command) {
 	cmd.Flags().BoolVarP(&debug, "debug", "d", false, "enable debug logging")
 	cmd.Flags().BoolVarP(&silent, "silent", "s", false, "disable logging (except errors)")
 }
 
+// timeoutContext returns a context canceled on timeout or interrupt (Ctrl+C).
 func timeoutContext(ctx context.Context) (context.Context, context.CancelFunc) {
-	return util.ContextWithOptionalTimeout(ctx, timeout)
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	ctx, cancel := util.ContextWithOptionalTimeout(ctx, timeout)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+func retryPolicy() retry.Policy {
+	return retry.Policy{
+		Retries:  retries,
+		MinDelay: retryDelay,
+		MaxDelay: retryMaxDelay,
+	}
+}
+
+// transportConfig merges the http flags into the http section of the config file.
+func transportConfig() transport.Config {
+	tc := transport.Config{
+		CAFile:         cfg.HTTP.CAFile,
+		CertFile:       cfg.HTTP.ClientCert,
+		KeyFile:        cfg.HTTP.ClientKey,
+		Proxy:          cfg.HTTP.Proxy,
+		UserAgent:      cfg.HTTP.UserAgent,
+		ConnectTimeout: cfg.HTTP.ConnectTimeout,
+		IdleTimeout:    cfg.HTTP.IdleTimeout,
+		Retry:          retryPolicy(),
+	}
+	for _, f := range []struct {
+		dst *string
+		src string
+	}{
+		{&tc.CAFile, caFile},
+		{&tc.CertFile, clientCert},
+		{&tc.KeyFile, clientKey},
+		{&tc.Proxy, proxy},
+		{&tc.UserAgent, userAgent},
+	} {
+		if f.src != "" {
+			*f.dst = f.src
+		}
+	}
+	if connectTimeout > 0 {
+		tc.ConnectTimeout = connectTimeout
+	}
+	if idleTimeout > 0 {
+		tc.IdleTimeout = idleTimeout
+	}
+	return tc
+}
+
+// httpClient returns the client shared by all cdns and the downloader, offline it only reads the mirror.
+func httpClient() (*http.Client, error) {
+	if client != nil {
+		return client, nil
+	}
+
+	if offline {
+		client = &http.Client{
+			Transport: mirror.NewTransport(mirrorDir),
+		}
+		return client, nil
+	}
+
+	c, err := transport.New(transportConfig())
+	if err != nil {
+		return nil, err
+	}
+	client = c
+	return client, nil
 }
 
-func experimentalGithubCDN() {
+// setupCDNs hands the http client to all cdns, adds the mirrors of the config file and the experimental github cdn if requested.
+func setupCDNs() {
+	c, err := httpClient()
+	if err != nil {
+		logging.ErrLogger.Fatalf("invalid http settings: %v", err)
+	}
+	vcs.DefaultRegistry.SetHTTPClient(c)
+
+	for _, mirror := range mirrorCDNs() {
+		logging.DebugLogger.Printf("using mirror %s", mirror.Name())
+		vcs.DefaultRegistry.AddCDN(mirror)
+	}
 	if github {
 		vcs.DefaultRegistry.AddCDN(ghcdn.New(ghcdn.ModuleMap{
 			"go-module":    gomodule.New(),
 			"js-module-v2": jsmodulev2.New(),
 		}))
 	}
+
+	for name, creds := range credentials {
+		if name == ghcdn.Name && !github {
+			continue
+		}
+		vcs.DefaultRegistry.SetCredentials(name, creds)
+	}
+}
+
+// vcsOptions returns the downloader, updater and checker options set by flags.
+func vcsOptions() []vcs.Option {
+	opts := []vcs.Option{
+		vcs.WithConcurrency(concurrency, hostConcurrency),
+		vcs.WithSegments(segments, segmentThreshold<<20),
+		vcs.WithRetry(retryPolicy()),
+	}
+	if bar != nil {
+		opts = append(opts, vcs.WithObserver(bar))
+	}
+	if !noCache && cacheDir != "" {
+		opts = append(opts, vcs.WithCache(cache.New(cacheDir)))
+	}
+	if offline {
+		opts = append(opts, vcs.WithOffline())
+	}
+
+	// the rates have been validated by setupConfig already
+	rate := cfg.LimitRate
+	if limitRate != "" {
+		rate = limitRate
+	}
+	if n, _ := parseRate(rate); n > 0 {
+		opts = append(opts, vcs.WithRateLimit(n))
+	}
+	for name, c := range cfg.CDNs {
+		if c == nil {
+			continue
+		}
+		if n, _ := parseRate(c.LimitRate); n > 0 {
+			opts = append(opts, vcs.WithCDNRateLimit(name, n))
+		}
+	}
+	return opts
+}
+
+// parseSize parses a size in bytes with an optional binary unit suffix, e.g. 512K, 10GiB or 1.5g.
+func parseSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		size   float64
+	}{
+		{"t", 1 << 40},
+		{"g", 1 << 30},
+		{"m", 1 << 20},
+		{"k", 1 << 10},
+		{"", 1},
+	}
+
+	num := strings.TrimSuffix(strings.TrimSuffix(strings.ToLower(strings.TrimSpace(s)), "b"), "i")
+	for _, unit := range units {
+		if !strings.HasSuffix(num, unit.suffix) {
+			continue
+		}
+
+		n, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(num, unit.suffix)), 64)
+		if err != nil || math.IsNaN(n) || n < 0 || n*unit.size >= math.MaxInt64 {
+			return 0, fmt.Errorf("expected a size like 500M or 10G, got %q", s)
+		}
+		return int64(n * unit.size), nil
+	}
+	return 0, nil
+}
+
+// parseRate parses a throughput in bytes per second like parseSize, an empty rate is unlimited.
+func parseRate(s string) (int64, error) {
+	if strings.TrimSpace(s) == "" {
+		return 0, nil
+	}
+	return parseSize(s)
 }
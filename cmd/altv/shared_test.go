@@ -0,0 +1,67 @@
+package main
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"1024", 1024, false},
+		{"512K", 512 << 10, false},
+		{"512k", 512 << 10, false},
+		{"500M", 500 << 20, false},
+		{"10GiB", 10 << 30, false},
+		{"10gb", 10 << 30, false},
+		{"1.5g", 3 << 29, false},
+		{"2T", 2 << 40, false},
+		{" 5 M ", 5 << 20, false},
+		{"0", 0, false},
+		{"", 0, true},
+		{"M", 0, true},
+		{"-1M", 0, true},
+		{"10X", 0, true},
+		{"nan", 0, true},
+		{"inf", 0, true},
+		{"9999999T", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseSize(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSize(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseSize(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"  ", 0, false},
+		{"5M", 5 << 20, false},
+		{"100k", 100 << 10, false},
+		{"fast", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseRate(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRate(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseRate(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/timo972/altv-cli/pkg/logging"
+	"github.com/timo972/altv-cli/pkg/vcs"
+)
+
+var keepSnapshots int
+
+var snapshotsCmd = &cobra.Command{
+	Use:   "snapshots",
+	Short: "Manage update snapshots",
+	Long:  `List or prune the snapshots kept by updates for rollbacks.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Usage()
+	},
+}
+
+var snapshotsListCmd = &cobra.Command{
+	Use:     "list",
+	Short:   "List update snapshots",
+	Aliases: []string{"ls"},
+	Run: func(cmd *cobra.Command, args []string) {
+		logging.SetDebug(debug)
+		if silent {
+			logging.Disable()
+		}
+
+		snaps, err := vcs.NewSnapshotStore(path).List()
+		if err != nil {
+			logging.ErrLogger.Fatalln(err)
+		}
+
+		if structuredOutput() {
+			printOutput(snaps)
+			return
+		}
+
+		if len(snaps) == 0 {
+			logging.InfoLogger.Println("no snapshots found")
+			return
+		}
+
+		for _, snap := range snaps {
+			logging.InfoLogger.Printf("%s  %s  %s", snap.ID, snap.Created.Format("2006-01-02 15:04:05"), snapshotModules(snap))
+		}
+	},
+}
+
+var snapshotsPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete old update snapshots",
+	Run: func(cmd *cobra.Command, args []string) {
+		logging.SetDebug(debug)
+		if silent {
+			logging.Disable()
+		}
+
+		pruned, err := vcs.NewSnapshotStore(path).Prune(keepSnapshots)
+		if err != nil {
+			logging.ErrLogger.Fatalln(err)
+		}
+
+		for _, snap := range pruned {
+			logging.InfoLogger.Printf("deleted snapshot %s", snap.ID)
+		}
+		logging.InfoLogger.Printf("deleted %d snapshots", len(pruned))
+	},
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{snapshotsListCmd, snapshotsPruneCmd} {
+		setPathFlag(cmd)
+		setLogFlags(cmd)
+		snapshotsCmd.AddCommand(cmd)
+	}
+	snapshotsPruneCmd.Flags().IntVarP(&keepSnapshots, "keep", "k", 3, "number of latest snapshots to keep")
+	rootCmd.AddCommand(snapshotsCmd)
+}
+
+func snapshotModules(snap *vcs.Snapshot) string {
+	mods := make([]string, len(snap.Modules))
+	for i, mod := range snap.Modules {
+		mods[i] = fmt.Sprintf("%s %s -> %s", mod.Module, versionOrNone(mod.Version), mod.ToVersion)
+	}
+	return strings.Join(mods, ", ")
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"log"
+
 	"github.com/spf13/cobra"
 	"github.com/timo972/altv-cli/pkg/logging"
 	"github.com/timo972/altv-cli/pkg/platform"
@@ -8,6 +10,10 @@ import (
 	"github.com/timo972/altv-cli/pkg/version"
 )
 
+var noPrune bool
+var dryRun bool
+var noSnapshot bool
+
 var updateCmd = &cobra.Command{
 	Use:     "update",
 	Short:   "Update alt:V server",
@@ -21,21 +27,75 @@ var updateCmd = &cobra.Command{
 
 		logging.InfoLogger.Println("alt:V server updater")
 
-		experimentalGithubCDN()
-		upd := vcs.NewUpdater(platform.Arch(arch), version.Branch(branch), modules, vcs.DefaultRegistry)
+		setupCDNs()
+
+		// without -m the installed modules are updated, the default of the flag only applies to fresh installations
+		mods := modules
+		if !cmd.Flags().Changed("modules") {
+			installed, err := vcs.InstalledModules(path)
+			if err != nil {
+				logging.WarnLogger.Printf("unable to find installed modules: %v", err)
+			}
+			if len(installed) > 0 {
+				mods = installed
+			}
+		}
+
+		startProgress()
+		upd := vcs.NewUpdater(platform.Arch(arch), version.Branch(branch), mods, vcs.DefaultRegistry, vcsOptions()...)
 
 		ctx, cancel := timeoutContext(cmd.Context())
 		defer cancel()
 
-		if err := upd.Update(ctx, path); err != nil {
-			logging.ErrLogger.Fatalln(err)
+		result, err := upd.Update(ctx, path, vcs.UpdateOptions{
+			Prune:    !noPrune,
+			DryRun:   dryRun,
+			Snapshot: !noSnapshot,
+		})
+		stopProgress()
+		if structuredOutput() {
+			printOutput(newTransferOutput(result, err))
+		} else if err == nil || vcs.IsPartial(err) {
+			printUpdate(logging.InfoLogger, result)
 		}
+		exit(nil, err)
 
-		logging.InfoLogger.Println("successfully installed")
+		if !dryRun {
+			logging.InfoLogger.Println("successfully updated")
+		}
 	},
 }
 
 func init() {
 	setFlags(updateCmd)
+	updateCmd.Flags().BoolVar(&noPrune, "no-prune", false, "keep files that were removed from a module upstream")
+	updateCmd.Flags().BoolVar(&dryRun, "dry-run", false, "only print the planned changes, do not touch the installation")
+	updateCmd.Flags().BoolVar(&noSnapshot, "no-snapshot", false, "do not keep a snapshot of the replaced files for rollbacks")
 	rootCmd.AddCommand(updateCmd)
 }
+
+func printUpdate(logger *log.Logger, result vcs.UpdateResult) {
+	for _, mod := range result {
+		changed := mod.Changed()
+		if len(changed) == 0 {
+			logger.Printf("%s is up to date (%s)", mod.Module, mod.ToVersion)
+			continue
+		}
+
+		if mod.FromVersion == mod.ToVersion {
+			logger.Printf("%s %s, %d files changed:", mod.Module, versionOrNone(mod.ToVersion), len(changed))
+		} else {
+			logger.Printf("%s updated %s -> %s, %d files changed:", mod.Module, versionOrNone(mod.FromVersion), mod.ToVersion, len(changed))
+		}
+		for _, file := range changed {
+			logger.Printf("  %-8s %s", file.Change, file.Name)
+		}
+	}
+}
+
+func versionOrNone(v string) string {
+	if v == "" {
+		return "none"
+	}
+	return v
+}
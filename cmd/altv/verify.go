@@ -12,11 +12,21 @@ import (
 )
 
 var noUpdate bool
+var repair bool
+var listFiles bool
 
 var verifyCmd = &cobra.Command{
-	Use:     "verify",
-	Short:   "Verify alt:V server",
-	Long:    "Verify the alt:V server in a directory.",
+	Use:   "verify",
+	Short: "Verify alt:V server",
+	Long: `Verify the alt:V server in a directory.
+
+Exit codes:
+  0  all modules are valid (and up to date with --fail-on-upgradable)
+  1  error
+  2  files of at least one module are missing or corrupted
+  3  a newer version of at least one module is available (only with --fail-on-upgradable)
+  4  the manifest of at least one module could not be fetched from its cdn, or files are missing offline
+  5  verification succeeded for some modules but failed for others`,
 	Aliases: []string{"v"},
 	Run: func(cmd *cobra.Command, args []string) {
 		logging.SetDebug(debug)
@@ -26,38 +36,94 @@ var verifyCmd = &cobra.Command{
 
 		logging.InfoLogger.Println("alt:V server verifier")
 
-		experimentalGithubCDN()
-		checker := vcs.NewChecker(platform.Arch(arch), version.Branch(branch), modules, vcs.DefaultRegistry)
+		setupCDNs()
+		startProgress()
 
 		ctx, cancel := timeoutContext(cmd.Context())
 		defer cancel()
 
-		status, err := checker.Verify(ctx, path, !noUpdate)
-		if err != nil {
-			logging.ErrLogger.Fatalln(err)
+		if repair {
+			upd := vcs.NewUpdater(platform.Arch(arch), version.Branch(branch), modules, vcs.DefaultRegistry, vcsOptions()...)
+			result, report, err := upd.Repair(ctx, path)
+			stopProgress()
+			if structuredOutput() {
+				out := newReportOutput(report, err)
+				out.Repaired = newTransferModules(result)
+				printOutput(out)
+			} else {
+				printUpdate(logging.InfoLogger, result)
+				if report != nil {
+					printSummary(logging.InfoLogger, report, listFiles)
+				}
+			}
+			exit(report.Status(), err)
+			return
 		}
 
-		printSummary(logging.InfoLogger, status)
+		checker := vcs.NewChecker(platform.Arch(arch), version.Branch(branch), modules, vcs.DefaultRegistry, vcsOptions()...)
+
+		report, err := checker.Report(ctx, path, !noUpdate)
+		stopProgress()
+		if structuredOutput() {
+			printOutput(newReportOutput(report, err))
+		} else if report != nil {
+			printSummary(logging.InfoLogger, report, listFiles)
+		}
+		exit(report.Status(), err)
 	},
 }
 
 func init() {
 	setFlags(verifyCmd)
 	verifyCmd.Flags().BoolVarP(&noUpdate, "no-update", "n", false, "do not check for updates, just verify files")
+	verifyCmd.Flags().BoolVarP(&repair, "repair", "r", false, "re-download files failing verification")
+	verifyCmd.Flags().BoolVarP(&listFiles, "list-files", "l", false, "list missing and corrupted files of every module")
+	verifyCmd.Flags().BoolVar(&failOnUpgradable, "fail-on-upgradable", false, "exit with code 3 if a newer version of a module is available")
 	rootCmd.AddCommand(verifyCmd)
 }
 
-func printSummary(logger *log.Logger, status vcs.ModuleStatusResult) {
+func printSummary(logger *log.Logger, report vcs.Report, files bool) {
 	head := "| %-18s | %-9s %1s | %-9s %1s |"
 	row := "| %-18s | %-19s | %-19s |"
 	logger.Printf("integrity / version summary")
 	logger.Printf(head, "Module", "Integrity", "[✅|💥|⭕]", "Version", "[✅|🔼|⭕]")
 	logger.Printf("|%s|", strings.Repeat("-", 66))
-	for mod, stat := range status {
-		emojis := statusToEmoji(stat)
+	for _, mod := range report.Modules() {
+		emojis := statusToEmoji(report[mod].Status)
 		logger.Printf(row, mod, emojis[0], emojis[1])
 	}
 
+	if !files {
+		return
+	}
+
+	for _, mod := range report.Modules() {
+		mr := report[mod]
+		failed := mr.Failed()
+		unverifiable := mr.Count(vcs.FileUnverifiable)
+		switch {
+		case mr.Missing():
+			logger.Printf("%s: not installed (%d files missing)", mod, len(failed))
+			continue
+		case len(failed) > 0:
+			logger.Printf("%s: %d of %d files failed verification", mod, len(failed), len(mr.Files))
+		case unverifiable > 0:
+			logger.Printf("%s: ok, %d files without checksum", mod, unverifiable)
+		default:
+			logger.Printf("%s: ok", mod)
+		}
+
+		for _, file := range failed {
+			if file.Archive != "" {
+				logger.Printf("  %-13s %s (from %s)", file.State, file.Name, file.Archive)
+				continue
+			}
+			logger.Printf("  %-13s %s", file.State, file.Name)
+		}
+		if upgradable := mr.Count(vcs.FileUpgradable); upgradable > 0 {
+			logger.Printf("  %d files upgradable", upgradable)
+		}
+	}
 }
 
 func statusToEmoji(status vcs.ModuleStatus) [2]string {
@@ -5,6 +5,8 @@ go 1.21.1
 require (
 	github.com/google/go-github/v53 v53.2.0
 	github.com/spf13/cobra v1.7.0
+	github.com/ulikunitz/xz v0.5.12
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
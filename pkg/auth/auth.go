@@ -0,0 +1,154 @@
+// auth package adding credentials of private cdns and mirrors to their requests.
+package auth
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/textproto"
+)
+
+// Credentials authenticate the requests to a cdn, only one kind of credentials may be set.
+// They are redacted when formatted, so they can not end up in logs.
+type Credentials struct {
+	// Token is sent as bearer token in the Authorization header.
+	Token string `yaml:"token"`
+	// Username and Password are sent as basic auth.
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// Header and Value are sent as custom header, e.g. X-Api-Key.
+	Header string `yaml:"header"`
+	Value  string `yaml:"value"`
+}
+
+// Empty reports whether no credentials are set.
+func (c *Credentials) Empty() bool {
+	return c == nil || *c == Credentials{}
+}
+
+// Validate checks that exactly one kind of credentials is set completely.
+func (c *Credentials) Validate() error {
+	kinds := 0
+	if c.Token != "" {
+		kinds++
+	}
+	if c.Username != "" || c.Password != "" {
+		if c.Username == "" {
+			return fmt.Errorf("basic auth requires a username")
+		}
+		kinds++
+	}
+	if c.Header != "" || c.Value != "" {
+		if c.Header == "" || c.Value == "" {
+			return fmt.Errorf("custom header auth requires header and value")
+		}
+		// the name is not quoted, it may hold the secret if the whole header line was configured
+		if !validHeader(c.Header) {
+			return fmt.Errorf("invalid header name, it must not contain spaces, colons or control characters")
+		}
+		kinds++
+	}
+
+	switch kinds {
+	case 0:
+		return fmt.Errorf("no token, username or header set")
+	case 1:
+		return nil
+	default:
+		return fmt.Errorf("only one of token, username or header may be set")
+	}
+}
+
+func validHeader(name string) bool {
+	for _, r := range name {
+		if r <= ' ' || r >= 0x7f || r == ':' {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// Kind describes the kind of credentials without revealing them.
+func (c *Credentials) Kind() string {
+	switch {
+	case c.Empty():
+		return "none"
+	case c.Token != "":
+		return "bearer token"
+	case c.Username != "":
+		return "basic auth"
+	default:
+		return "header " + textproto.CanonicalMIMEHeaderKey(c.Header)
+	}
+}
+
+func (c *Credentials) String() string {
+	return "credentials(" + c.Kind() + ")"
+}
+
+func (c *Credentials) GoString() string {
+	return c.String()
+}
+
+// apply sets the credentials on the request.
+func (c *Credentials) apply(req *http.Request) {
+	switch {
+	case c.Token != "":
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	case c.Username != "":
+		req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(c.Username+":"+c.Password)))
+	case c.Header != "":
+		req.Header.Set(c.Header, c.Value)
+	}
+}
+
+// Transport adds the credentials to every request sent through it.
+// Redirects only keep the credentials if they stay on the same host, so they never leak to e.g. a storage host.
+type Transport struct {
+	Base        http.RoundTripper
+	Credentials *Credentials
+}
+
+func NewTransport(base http.RoundTripper, creds *Credentials) *Transport {
+	return &Transport{
+		Base:        base,
+		Credentials: creds,
+	}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	if t.Credentials.Empty() || !sameHostRedirect(req) {
+		return base.RoundTrip(req)
+	}
+
+	// a RoundTripper must not modify the request
+	req = req.Clone(req.Context())
+	t.Credentials.apply(req)
+	return base.RoundTrip(req)
+}
+
+// sameHostRedirect reports whether the request is no redirect or a redirect to the host of the original request.
+func sameHostRedirect(req *http.Request) bool {
+	for r := req; r.Response != nil && r.Response.Request != nil; r = r.Response.Request {
+		if r.Response.Request.URL.Host != req.URL.Host {
+			return false
+		}
+	}
+	return true
+}
+
+// Client returns a copy of the client sending the credentials with every request, the client itself if there are none.
+func Client(client *http.Client, creds *Credentials) *http.Client {
+	if creds.Empty() {
+		return client
+	}
+
+	c := *client
+	c.Transport = NewTransport(client.Transport, creds)
+	return &c
+}
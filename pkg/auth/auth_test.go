@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+const secret = "s3cr3t"
+
+func TestCredentialsRedacted(t *testing.T) {
+	tests := []struct {
+		name  string
+		creds *Credentials
+		kind  string
+	}{
+		{"token", &Credentials{Token: secret}, "bearer token"},
+		{"basic auth", &Credentials{Username: "deploy", Password: secret}, "basic auth"},
+		{"header", &Credentials{Header: "x-api-key", Value: secret}, "header X-Api-Key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+				got := fmt.Sprintf(format, tt.creds)
+				if strings.Contains(got, secret) || !strings.Contains(got, tt.kind) {
+					t.Errorf("%s formatted as %q", format, got)
+				}
+			}
+
+			// errors of requests sent with the credentials do not quote them
+			srv := httptest.NewServer(http.NotFoundHandler())
+			srv.Close()
+			u := strings.Replace(srv.URL, "http://", "http://deploy:"+secret+"@", 1)
+			_, err := Client(http.DefaultClient, tt.creds).Get(u + "/server/release/x64_linux/update.json")
+			if err == nil || strings.Contains(err.Error(), secret) {
+				t.Errorf("got error %v", err)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		creds   *Credentials
+		wantErr bool
+	}{
+		{"token", &Credentials{Token: secret}, false},
+		{"basic auth", &Credentials{Username: "deploy", Password: secret}, false},
+		{"header", &Credentials{Header: "X-Api-Key", Value: secret}, false},
+		{"empty", &Credentials{}, true},
+		{"password without username", &Credentials{Password: secret}, true},
+		{"header without value", &Credentials{Header: "X-Api-Key"}, true},
+		{"invalid header", &Credentials{Header: "X-Api-Key: " + secret, Value: secret}, true},
+		{"token and basic auth", &Credentials{Token: secret, Username: "deploy", Password: secret}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.creds.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && strings.Contains(err.Error(), secret) {
+				t.Errorf("error %q reveals the secret", err)
+			}
+		})
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		perm    os.FileMode
+		wantErr bool
+	}{
+		{"valid", "https://mirror.example.com:\n  username: deploy\n  password: " + secret + "\n", 0600, false},
+		{"accessible by others", "https://mirror.example.com:\n  token: " + secret + "\n", 0644, runtime.GOOS != "windows"},
+		{"invalid yaml", "https://mirror.example.com: [token: " + secret, 0600, true},
+		{"invalid credentials", "https://mirror.example.com:\n  token: " + secret + "\n  username: deploy\n", 0600, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "credentials.yaml")
+			if err := os.WriteFile(name, []byte(tt.content), tt.perm); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chmod(name, tt.perm); err != nil {
+				t.Fatal(err)
+			}
+
+			creds, err := ReadFile(name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if strings.Contains(err.Error(), secret) {
+					t.Errorf("error %q reveals the secret", err)
+				}
+				return
+			}
+			if c := creds["https://mirror.example.com"]; c == nil || c.Password != secret {
+				t.Errorf("got credentials %v", creds)
+			}
+		})
+	}
+}
+
+func TestTransportRedirects(t *testing.T) {
+	tests := []struct {
+		name string
+		// host the request is redirected to, empty for no redirect
+		redirect string
+		want     string
+	}{
+		{"no redirect", "", "Bearer " + secret},
+		{"same host", "127.0.0.1", "Bearer " + secret},
+		{"other host", "localhost", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/redirect" {
+					http.Redirect(w, r, "http://"+strings.Replace(r.Host, "127.0.0.1", tt.redirect, 1)+"/file", http.StatusFound)
+					return
+				}
+				got = r.Header.Get("Authorization")
+			}))
+			defer srv.Close()
+
+			path := "/file"
+			if tt.redirect != "" {
+				path = "/redirect"
+			}
+			resp, err := Client(http.DefaultClient, &Credentials{Token: secret}).Get(srv.URL + path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if got != tt.want {
+				t.Errorf("got Authorization %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
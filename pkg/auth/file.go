@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ReadFile reads the credentials per cdn name from the yaml file, e.g.
+//
+//	https://mirror.example.com:
+//	  username: deploy
+//	  password: secret
+//
+// The file must not be accessible by other users, except on windows, which has no unix permissions.
+func ReadFile(name string) (map[string]*Credentials, error) {
+	stat, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if perm := stat.Mode().Perm(); runtime.GOOS != "windows" && perm&0077 != 0 {
+		return nil, fmt.Errorf("credentials file %s is accessible by other users (%s), restrict it with chmod 600", name, perm)
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	creds := make(map[string]*Credentials)
+	// the yaml error is dropped, it may quote a secret
+	if err = yaml.Unmarshal(data, &creds); err != nil {
+		return nil, fmt.Errorf("invalid credentials file %s, expected credentials keyed by cdn name", name)
+	}
+	for cdn, c := range creds {
+		if c == nil {
+			delete(creds, cdn)
+			continue
+		}
+		if err = c.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid credentials of cdn %s in %s: %w", cdn, name, err)
+		}
+	}
+	return creds, nil
+}
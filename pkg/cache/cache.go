@@ -0,0 +1,319 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/timo972/altv-cli/pkg/logging"
+)
+
+// tempPrefix marks entries which are still being written, they are renamed into place once complete.
+const tempPrefix = ".tmp-"
+
+// staleTemp is the age from which on an incomplete entry is considered abandoned by a crashed process.
+const staleTemp = 24 * time.Hour
+
+// Entry is a file kept in the cache.
+type Entry struct {
+	Hash string    `json:"hash" yaml:"hash"`
+	Size int64     `json:"size" yaml:"size"`
+	Used time.Time `json:"used" yaml:"used"`
+}
+
+// Cache is a content-addressed store of downloaded files, keyed by their sha1 hash as listed in cdn manifests.
+// It is safe to be shared by multiple processes: entries are written to temporary files and renamed into place,
+// and every entry is verified against its hash when it is read, so a corrupted entry is removed and reported as a miss.
+type Cache interface {
+	// Dir returns the directory the cache is kept in.
+	Dir() string
+	// Get copies the entry of the hash to dst and reports whether it was found, dst is removed if the entry is corrupted.
+	Get(hash string, dst string) (bool, error)
+	// Has reports whether the entry of the hash exists, without verifying it.
+	Has(hash string) bool
+	// Put copies the content read from r into the cache, it has to match the hash.
+	Put(hash string, r io.Reader) error
+	// GetRecord decodes the json record stored under the key into v and reports whether it was found.
+	GetRecord(key string, v any) (bool, error)
+	// PutRecord stores v as json record under the key, e.g. the manifest a cdn returned for a module.
+	PutRecord(key string, v any) error
+	// List returns all entries, least recently used first.
+	List() ([]*Entry, error)
+	// Size returns the total size of all entries in bytes.
+	Size() (int64, error)
+	// GC deletes the least recently used entries until the cache is at most maxSize bytes large and returns the deleted ones.
+	GC(maxSize int64) ([]*Entry, error)
+}
+
+type cache struct {
+	dir string
+}
+
+// New returns the cache kept in dir, the directory is created on the first write.
+func New(dir string) Cache {
+	return &cache{dir: dir}
+}
+
+// DefaultDir returns the user cache directory of the cli, e.g. $XDG_CACHE_HOME/altv on linux.
+func DefaultDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "altv"), nil
+}
+
+func (c *cache) Dir() string {
+	return c.dir
+}
+
+func (c *cache) objects() string {
+	return filepath.Join(c.dir, "sha1")
+}
+
+// path returns the file of the entry, the hash is validated as it might come from a remote manifest.
+func (c *cache) path(hash string) (string, error) {
+	hash = strings.ToLower(hash)
+	if b, err := hex.DecodeString(hash); err != nil || len(b) != sha1.Size {
+		return "", fmt.Errorf("invalid sha1 hash %q", hash)
+	}
+	return filepath.Join(c.objects(), hash[:2], hash), nil
+}
+
+func (c *cache) Get(hash string, dst string) (bool, error) {
+	name, err := c.path(hash)
+	if err != nil {
+		return false, err
+	}
+
+	src, err := os.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer src.Close()
+
+	f, err := os.Create(dst)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	h := sha1.New()
+	_, err = io.Copy(io.MultiWriter(f, h), src)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return false, err
+	}
+	if checksum := hex.EncodeToString(h.Sum(nil)); checksum != strings.ToLower(hash) {
+		logging.WarnLogger.Printf("removing corrupted cache entry %s (got %s)", hash, checksum)
+		os.Remove(dst)
+		src.Close()
+		os.Remove(name)
+		return false, nil
+	}
+
+	// the modification time tracks the last use for gc
+	now := time.Now()
+	if err = os.Chtimes(name, now, now); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		logging.DebugLogger.Printf("unable to touch cache entry %s: %v", hash, err)
+	}
+	return true, nil
+}
+
+func (c *cache) Has(hash string) bool {
+	name, err := c.path(hash)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(name)
+	return err == nil
+}
+
+func (c *cache) Put(hash string, r io.Reader) error {
+	name, err := c.path(hash)
+	if err != nil {
+		return err
+	}
+
+	if _, err = os.Stat(name); err == nil {
+		now := time.Now()
+		return os.Chtimes(name, now, now)
+	}
+
+	h := sha1.New()
+	return writeAtomic(name, io.TeeReader(r, h), func() error {
+		if checksum := hex.EncodeToString(h.Sum(nil)); checksum != strings.ToLower(hash) {
+			return fmt.Errorf("checksum mismatch: expected %s, got %s", hash, checksum)
+		}
+		return nil
+	})
+}
+
+// record returns the file of the record, the key is hashed so it may contain any characters.
+func (c *cache) record(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return filepath.Join(c.dir, "records", hex.EncodeToString(sum[:])+".json")
+}
+
+func (c *cache) GetRecord(key string, v any) (bool, error) {
+	f, err := os.Open(c.record(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	if err = json.NewDecoder(f).Decode(v); err != nil {
+		return false, fmt.Errorf("broken cache record %s: %w", key, err)
+	}
+	return true, nil
+}
+
+func (c *cache) PutRecord(key string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return writeAtomic(c.record(key), bytes.NewReader(data), nil)
+}
+
+// writeAtomic writes the content of r to a temporary file next to name and renames it into place, if check passes.
+// Another process may write the same file at the same time, the last rename wins.
+func writeAtomic(name string, r io.Reader, check func() error) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), tempPrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, r)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && check != nil {
+		err = check()
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), name)
+}
+
+// walk calls fn for every complete entry and removes abandoned temporary files.
+func (c *cache) walk(fn func(entry *Entry)) error {
+	err := filepath.WalkDir(c.objects(), func(name string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			// removed by another process in the meantime
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if strings.HasPrefix(d.Name(), tempPrefix) {
+			if time.Since(info.ModTime()) > staleTemp {
+				logging.DebugLogger.Printf("removing abandoned cache file %s", name)
+				os.Remove(name)
+			}
+			return nil
+		}
+		if _, err = c.path(d.Name()); err != nil {
+			// not an entry of the cache, leave it alone
+			return nil
+		}
+
+		fn(&Entry{
+			Hash: d.Name(),
+			Size: info.Size(),
+			Used: info.ModTime(),
+		})
+		return nil
+	})
+	return err
+}
+
+func (c *cache) List() ([]*Entry, error) {
+	entries := []*Entry{}
+	if err := c.walk(func(entry *Entry) {
+		entries = append(entries, entry)
+	}); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Used.Before(entries[j].Used)
+	})
+	return entries, nil
+}
+
+func (c *cache) Size() (int64, error) {
+	var size int64
+	err := c.walk(func(entry *Entry) {
+		size += entry.Size
+	})
+	return size, err
+}
+
+func (c *cache) GC(maxSize int64) ([]*Entry, error) {
+	entries, err := c.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var size int64
+	for _, entry := range entries {
+		size += entry.Size
+	}
+
+	deleted := []*Entry{}
+	for _, entry := range entries {
+		if size <= maxSize {
+			break
+		}
+
+		name, _ := c.path(entry.Hash)
+		logging.DebugLogger.Printf("deleting cache entry %s", entry.Hash)
+		if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return deleted, fmt.Errorf("unable to delete cache entry %s: %w", entry.Hash, err)
+		}
+		size -= entry.Size
+		deleted = append(deleted, entry)
+	}
+	return deleted, nil
+}
@@ -0,0 +1,151 @@
+package cache
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func hashOf(content string) string {
+	sum := sha1.Sum([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestPutGet(t *testing.T) {
+	tests := []struct {
+		name    string
+		hash    string
+		content string
+		wantErr bool
+	}{
+		{"matching hash", hashOf("altv-server"), "altv-server", false},
+		{"upper case hash", strings.ToUpper(hashOf("altv-server")), "altv-server", false},
+		{"checksum mismatch", hashOf("altv-server"), "tampered", true},
+		{"invalid hash", "../../etc/passwd", "altv-server", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(t.TempDir())
+
+			err := c.Put(tt.hash, strings.NewReader(tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Put error = %v, want error %v", err, tt.wantErr)
+			}
+			if has := c.Has(tt.hash); has == tt.wantErr {
+				t.Errorf("Has = %v after Put", has)
+			}
+
+			dst := filepath.Join(t.TempDir(), "file")
+			ok, err := c.Get(tt.hash, dst)
+			if tt.wantErr {
+				if ok {
+					t.Error("Get found a rejected entry")
+				}
+				return
+			}
+			if err != nil || !ok {
+				t.Fatalf("Get = %v, %v", ok, err)
+			}
+			if data, err := os.ReadFile(dst); err != nil || string(data) != tt.content {
+				t.Errorf("got %q, %v, want %q", data, err, tt.content)
+			}
+		})
+	}
+}
+
+func TestGetCorrupted(t *testing.T) {
+	c := New(t.TempDir())
+	hash := hashOf("altv-server")
+	if err := c.Put(hash, strings.NewReader("altv-server")); err != nil {
+		t.Fatal(err)
+	}
+
+	name, _ := c.(*cache).path(hash)
+	if err := os.WriteFile(name, []byte("corrupted"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(t.TempDir(), "file")
+	ok, err := c.Get(hash, dst)
+	if err != nil || ok {
+		t.Fatalf("Get = %v, %v, want a miss", ok, err)
+	}
+	if c.Has(hash) {
+		t.Error("corrupted entry has not been removed")
+	}
+	if _, err = os.Stat(dst); err == nil {
+		t.Error("corrupted entry has been copied")
+	}
+}
+
+func TestRecords(t *testing.T) {
+	c := New(t.TempDir())
+
+	var v map[string]int
+	if ok, err := c.GetRecord("manifest/server", &v); err != nil || ok {
+		t.Fatalf("GetRecord = %v, %v before PutRecord", ok, err)
+	}
+
+	if err := c.PutRecord("manifest/server", map[string]int{"latestBuildNumber": 1234}); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := c.GetRecord("manifest/server", &v); err != nil || !ok || v["latestBuildNumber"] != 1234 {
+		t.Fatalf("GetRecord = %v, %v, %v", ok, err, v)
+	}
+}
+
+func TestGC(t *testing.T) {
+	// entries from least to most recently used, 10 bytes each
+	contents := []string{"0123456789", "abcdefghij", "klmnopqrst"}
+
+	tests := []struct {
+		maxSize int64
+		deleted int
+	}{
+		{30, 0},
+		{29, 1},
+		{20, 1},
+		{10, 2},
+		{0, 3},
+	}
+
+	for _, tt := range tests {
+		c := New(t.TempDir())
+		for i, content := range contents {
+			hash := hashOf(content)
+			if err := c.Put(hash, strings.NewReader(content)); err != nil {
+				t.Fatal(err)
+			}
+			name, _ := c.(*cache).path(hash)
+			used := time.Now().Add(time.Duration(i-len(contents)) * time.Hour)
+			if err := os.Chtimes(name, used, used); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		deleted, err := c.GC(tt.maxSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(deleted) != tt.deleted {
+			t.Fatalf("GC(%d) deleted %d entries, want %d", tt.maxSize, len(deleted), tt.deleted)
+		}
+		for i, entry := range deleted {
+			if entry.Hash != hashOf(contents[i]) {
+				t.Errorf("GC(%d) deleted %s, want the least recently used %s", tt.maxSize, entry.Hash, hashOf(contents[i]))
+			}
+			if c.Has(entry.Hash) {
+				t.Errorf("GC(%d) left %s behind", tt.maxSize, entry.Hash)
+			}
+		}
+
+		if size, err := c.Size(); err != nil || size > tt.maxSize {
+			t.Errorf("GC(%d) left %d bytes, %v", tt.maxSize, size, err)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package altcdn
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -8,6 +9,7 @@ import (
 	"github.com/timo972/altv-cli/pkg/cdn"
 	"github.com/timo972/altv-cli/pkg/logging"
 	"github.com/timo972/altv-cli/pkg/platform"
+	"github.com/timo972/altv-cli/pkg/retry"
 	"github.com/timo972/altv-cli/pkg/version"
 )
 
@@ -16,6 +18,7 @@ type ModuleMap map[string]string
 type altCDN struct {
 	BaseURL  string
 	includes ModuleMap
+	client   *http.Client
 }
 
 var BaseURL = "https://cdn.alt-mp.com"
@@ -31,12 +34,14 @@ var DefaultModules = ModuleMap{
 var Default cdn.CDN = &altCDN{
 	BaseURL:  BaseURL,
 	includes: DefaultModules,
+	client:   retry.DefaultClient,
 }
 
 func New(baseURL string, modules ModuleMap) *altCDN {
 	return &altCDN{
-		BaseURL:  BaseURL,
+		BaseURL:  baseURL,
 		includes: modules,
+		client:   retry.DefaultClient,
 	}
 }
 
@@ -48,21 +53,34 @@ func (c *altCDN) SetModules(modules ModuleMap) {
 	c.includes = modules
 }
 
+func (c *altCDN) SetHTTPClient(client *http.Client) {
+	c.client = client
+}
+
+func (c *altCDN) Name() string {
+	return c.BaseURL
+}
+
 func (c *altCDN) Has(module string) bool {
 	_, ok := c.includes[module]
 	return ok
 }
 
-func (c *altCDN) Manifest(branch version.Branch, arch platform.Arch, module string) (*cdn.Manifest, error) {
+func (c *altCDN) Manifest(ctx context.Context, branch version.Branch, arch platform.Arch, module string) (*cdn.Manifest, error) {
 	manUrl := c.fileURL(branch, arch, module, "update.json")
 	logging.DebugLogger.Printf("Fetching manifest from %s", manUrl)
 
-	resp, err := http.DefaultClient.Get(manUrl)
-	logging.DebugLogger.Printf("Got response: %s", resp.Status)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, manUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	logging.DebugLogger.Printf("Got response: %s", resp.Status)
 
 	if resp.StatusCode != http.StatusOK {
 		logging.DebugLogger.Printf("Failed to fetch manifest from %s: %s", manUrl, resp.Status)
@@ -86,10 +104,10 @@ func (c *altCDN) fileURL(branch version.Branch, arch platform.Arch, module strin
 	return fmt.Sprintf("%s/"+c.includes[module]+"/%s", c.BaseURL, branch, arch, name)
 }
 
-func (c *altCDN) Files(branch version.Branch, arch platform.Arch, module string, manifest bool) ([]*cdn.File, error) {
-	man, err := c.Manifest(branch, arch, module)
+func (c *altCDN) Files(ctx context.Context, branch version.Branch, arch platform.Arch, module string, manifest bool) (*cdn.Manifest, []*cdn.File, error) {
+	man, err := c.Manifest(ctx, branch, arch, module)
 	if err != nil {
-		return nil, fmt.Errorf("unable to gather module files: %w", err)
+		return nil, nil, fmt.Errorf("unable to gather module files: %w", err)
 	}
 
 	logging.DebugLogger.Println("got manifest")
@@ -103,10 +121,12 @@ func (c *altCDN) Files(branch version.Branch, arch platform.Arch, module string,
 	i := 0
 	if manifest {
 		files[i] = &cdn.File{
-			Type: cdn.ModuleManifestFile,
-			Name: fmt.Sprintf("%s.update.json", module),
-			Hash: "",
-			Url:  c.fileURL(branch, arch, module, "update.json"),
+			Type:   cdn.ModuleManifestFile,
+			Module: module,
+			Name:   cdn.ManifestFileName(module),
+			Hash:   "",
+			Size:   -1,
+			Url:    c.fileURL(branch, arch, module, "update.json"),
 		}
 		i++
 	}
@@ -114,15 +134,17 @@ func (c *altCDN) Files(branch version.Branch, arch platform.Arch, module string,
 	for name, hash := range man.HashList {
 		logging.DebugLogger.Printf("adding file %s", name)
 		files[i] = &cdn.File{
-			Type: cdn.ModuleFile,
-			Name: name,
-			Hash: hash,
-			Url:  c.fileURL(branch, arch, module, name),
+			Type:   cdn.ModuleFile,
+			Module: module,
+			Name:   name,
+			Hash:   hash,
+			Size:   man.SizeList[name],
+			Url:    c.fileURL(branch, arch, module, name),
 		}
 		i++
 	}
 
 	logging.DebugLogger.Println("extracted files")
 
-	return files, nil
+	return man, files, nil
 }
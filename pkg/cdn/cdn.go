@@ -1,6 +1,7 @@
 package cdn
 
 import (
+	"context"
 	"io"
 
 	"github.com/timo972/altv-cli/pkg/platform"
@@ -14,13 +15,26 @@ const (
 	ModuleManifestFile
 )
 
+// ManifestFileSuffix is appended to the module name to build the local manifest file name.
+const ManifestFileSuffix = ".update.json"
+
+// ManifestFileName returns the name of the local manifest file for the given module.
+func ManifestFileName(module string) string {
+	return module + ManifestFileSuffix
+}
+
 type CDN interface {
+	// Name identifies the CDN, e.g. in lockfiles.
+	Name() string
 	// Has checks wether the CDN hosts the given module files.
 	Has(module string) bool
 	// Manifest returns the manifest for the given branch, arch and module.
-	Manifest(branch version.Branch, arch platform.Arch, module string) (*Manifest, error)
-	// Files returns a list of required files for the given branch, arch and module.
-	Files(branch version.Branch, arch platform.Arch, module string, manifest bool) ([]*File, error)
+	// Canceling the context aborts the requests made for it.
+	Manifest(ctx context.Context, branch version.Branch, arch platform.Arch, module string) (*Manifest, error)
+	// Files returns the manifest and the list of required files built from it for the given branch, arch and module.
+	// The manifest is fetched once, so the files always match it.
+	// Canceling the context aborts the requests made for it.
+	Files(ctx context.Context, branch version.Branch, arch platform.Arch, module string, manifest bool) (*Manifest, []*File, error)
 }
 
 type Manifest struct {
@@ -33,9 +47,12 @@ type Manifest struct {
 
 type File struct {
 	Type FileType
-	Name string
-	Url  string
-	Hash string
+	// Module the file belongs to.
+	Module string
+	Name   string
+	Url    string
+	Hash   string
+	Size   int
 }
 
 type BuiltFile struct {
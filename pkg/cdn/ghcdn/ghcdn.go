@@ -3,11 +3,13 @@ package ghcdn
 import (
 	"context"
 	"fmt"
+	"net/http"
 
 	"github.com/google/go-github/v53/github"
 	"github.com/timo972/altv-cli/pkg/cdn"
 	"github.com/timo972/altv-cli/pkg/logging"
 	"github.com/timo972/altv-cli/pkg/platform"
+	"github.com/timo972/altv-cli/pkg/retry"
 	"github.com/timo972/altv-cli/pkg/version"
 )
 
@@ -39,10 +41,14 @@ type ModuleMap map[string]*Repository
 func New(modules ModuleMap) *CDN {
 	return &CDN{
 		modules: modules,
-		client:  github.NewClient(nil),
+		client:  github.NewClient(retry.DefaultClient),
 	}
 }
 
+func (c *CDN) SetHTTPClient(client *http.Client) {
+	c.client = github.NewClient(client)
+}
+
 func NewRepo(owner string, name string, releaseFilter ReleaseFilter, assetFilter AssetFilter, manBuilder ManifestBuilder) *Repository {
 	return &Repository{
 		Name:            name,
@@ -53,6 +59,13 @@ func NewRepo(owner string, name string, releaseFilter ReleaseFilter, assetFilter
 	}
 }
 
+// Name identifies the github cdn, e.g. in lockfiles and the config file.
+const Name = "github"
+
+func (c *CDN) Name() string {
+	return Name
+}
+
 func (c *CDN) Has(module string) bool {
 	_, ok := c.modules[module]
 	return ok
@@ -62,9 +75,9 @@ func (c *CDN) Repo(module string) *Repository {
 	return c.modules[module]
 }
 
-func (c *CDN) matchingRelease(branch version.Branch, arch platform.Arch, module string) (*Repository, *github.RepositoryRelease, error) {
+func (c *CDN) matchingRelease(ctx context.Context, branch version.Branch, arch platform.Arch, module string) (*Repository, *github.RepositoryRelease, error) {
 	repo := c.Repo(module)
-	releases, _, err := c.client.Repositories.ListReleases(context.Background(), repo.Owner, repo.Name, nil)
+	releases, _, err := c.client.Repositories.ListReleases(ctx, repo.Owner, repo.Name, nil)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -74,8 +87,8 @@ func (c *CDN) matchingRelease(branch version.Branch, arch platform.Arch, module
 	return repo, release, err
 }
 
-func (c *CDN) buildManifest(branch version.Branch, arch platform.Arch, module string) (*cdn.Manifest, DownloadURLMap, error) {
-	repo, target, err := c.matchingRelease(branch, arch, module)
+func (c *CDN) buildManifest(ctx context.Context, branch version.Branch, arch platform.Arch, module string) (*cdn.Manifest, DownloadURLMap, error) {
+	repo, target, err := c.matchingRelease(ctx, branch, arch, module)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -88,15 +101,15 @@ func (c *CDN) buildManifest(branch version.Branch, arch platform.Arch, module st
 	return repo.ManifestBuilder(branch, arch, target, assets)
 }
 
-func (c *CDN) Manifest(branch version.Branch, arch platform.Arch, module string) (*cdn.Manifest, error) {
-	manifest, _, err := c.buildManifest(branch, arch, module)
+func (c *CDN) Manifest(ctx context.Context, branch version.Branch, arch platform.Arch, module string) (*cdn.Manifest, error) {
+	manifest, _, err := c.buildManifest(ctx, branch, arch, module)
 	return manifest, err
 }
 
-func (c *CDN) Files(branch version.Branch, arch platform.Arch, module string, manifest bool) ([]*cdn.File, error) {
-	man, urls, err := c.buildManifest(branch, arch, module)
+func (c *CDN) Files(ctx context.Context, branch version.Branch, arch platform.Arch, module string, manifest bool) (*cdn.Manifest, []*cdn.File, error) {
+	man, urls, err := c.buildManifest(ctx, branch, arch, module)
 	if err != nil {
-		return nil, fmt.Errorf("unable to build module manifest (github): %w", err)
+		return nil, nil, fmt.Errorf("unable to build module manifest (github): %w", err)
 	}
 
 	logging.DebugLogger.Println("got manifest")
@@ -106,15 +119,17 @@ func (c *CDN) Files(branch version.Branch, arch platform.Arch, module string, ma
 	for name, hash := range man.HashList {
 		logging.DebugLogger.Printf("adding file %s", name)
 		files[i] = &cdn.File{
-			Type: cdn.ModuleFile,
-			Name: name,
-			Hash: hash,
-			Url:  urls[name],
+			Type:   cdn.ModuleFile,
+			Module: module,
+			Name:   name,
+			Hash:   hash,
+			Size:   man.SizeList[name],
+			Url:    urls[name],
 		}
 		i++
 	}
 
 	logging.DebugLogger.Println("extracted files")
 
-	return files, nil
+	return man, files, nil
 }
@@ -0,0 +1,255 @@
+package extract
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/timo972/altv-cli/pkg/logging"
+	"github.com/ulikunitz/xz"
+)
+
+// Entry is a file extracted from an archive.
+type Entry struct {
+	// Name is the slash separated path of the file, relative to the directory the archive was extracted into.
+	Name string      `json:"name"`
+	Size int64       `json:"size"`
+	Mode fs.FileMode `json:"mode"`
+	Hash string      `json:"hash"`
+}
+
+var formats = []string{".zip", ".tar.gz", ".tgz", ".tar.xz", ".txz"}
+
+// Supported reports whether the file is an archive Extract can handle, judged by its extension.
+func Supported(name string) bool {
+	for _, ext := range formats {
+		if strings.HasSuffix(strings.ToLower(name), ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// member is a file or directory of an archive.
+type member struct {
+	name string
+	mode fs.FileMode
+	open func() (io.ReadCloser, error)
+}
+
+// Extract extracts the archive into dir and returns the extracted files.
+// Members escaping dir, symlinks and other special files are rejected, directories are created and file modes preserved.
+// Extraction stops at the first error, files extracted up to then are left in place.
+func Extract(archive, dir string) ([]*Entry, error) {
+	x := &extractor{dir: dir, entries: make([]*Entry, 0)}
+
+	var err error
+	switch name := strings.ToLower(archive); {
+	case strings.HasSuffix(name, ".zip"):
+		err = x.zip(archive)
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		err = x.tar(archive, func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		})
+	case strings.HasSuffix(name, ".tar.xz"), strings.HasSuffix(name, ".txz"):
+		err = x.tar(archive, func(r io.Reader) (io.ReadCloser, error) {
+			xr, err := xz.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			// the xz reader holds no resources
+			return io.NopCloser(xr), nil
+		})
+	default:
+		err = fmt.Errorf("unsupported archive format")
+	}
+	if err != nil {
+		return x.entries, fmt.Errorf("failed to extract %s: %w", filepath.Base(archive), err)
+	}
+	return x.entries, nil
+}
+
+type extractor struct {
+	dir     string
+	entries []*Entry
+}
+
+func (x *extractor) zip(archive string) error {
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		if err = x.extract(&member{name: f.Name, mode: f.Mode(), open: f.Open}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *extractor) tar(archive string, decompress func(io.Reader) (io.ReadCloser, error)) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dr, err := decompress(f)
+	if err != nil {
+		return err
+	}
+	defer dr.Close()
+
+	tr := tar.NewReader(dr)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		m := &member{
+			name: hdr.Name,
+			mode: hdr.FileInfo().Mode(),
+			open: func() (io.ReadCloser, error) {
+				return io.NopCloser(tr), nil
+			},
+		}
+		switch hdr.Typeflag {
+		case tar.TypeXGlobalHeader:
+			continue
+		case tar.TypeLink:
+			return fmt.Errorf("%s: hard links are not supported", hdr.Name)
+		}
+		if err = x.extract(m); err != nil {
+			return err
+		}
+	}
+}
+
+// target resolves the member name inside dir and rejects names escaping it.
+func (x *extractor) target(name string) (string, string, error) {
+	clean := path.Clean(strings.ReplaceAll(name, "\\", "/"))
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") || filepath.VolumeName(clean) != "" {
+		return "", "", fmt.Errorf("%s: path escapes the target directory", name)
+	}
+	return clean, filepath.Join(x.dir, filepath.FromSlash(clean)), nil
+}
+
+// checkParents rejects targets whose parent directories are symlinks, they could redirect the file out of dir.
+func (x *extractor) checkParents(clean string) error {
+	dir := x.dir
+	for _, part := range strings.Split(path.Dir(clean), "/") {
+		if part == "." {
+			break
+		}
+		dir = filepath.Join(dir, part)
+		stat, err := os.Lstat(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if stat.Mode()&fs.ModeSymlink != 0 {
+			return fmt.Errorf("%s: parent directory %s is a symlink", clean, part)
+		}
+	}
+	return nil
+}
+
+func (x *extractor) extract(m *member) error {
+	clean, target, err := x.target(m.name)
+	if err != nil {
+		return err
+	}
+	if clean == "." {
+		return nil
+	}
+	if err = x.checkParents(clean); err != nil {
+		return err
+	}
+
+	switch {
+	case m.mode.IsDir():
+		// the owner needs to be able to create the files inside
+		if err = os.MkdirAll(target, m.mode.Perm()|0700); err != nil {
+			return err
+		}
+		return os.Chmod(target, m.mode.Perm()|0700)
+	case m.mode&fs.ModeSymlink != 0:
+		return fmt.Errorf("%s: symlinks are not supported", m.name)
+	case !m.mode.IsRegular():
+		return fmt.Errorf("%s: unsupported file type %s", m.name, m.mode.Type())
+	}
+
+	if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	entry, err := writeFile(target, m)
+	if err != nil {
+		return fmt.Errorf("%s: %w", m.name, err)
+	}
+	entry.Name = clean
+	logging.DebugLogger.Printf("extracted %s", clean)
+	x.entries = append(x.entries, entry)
+	return nil
+}
+
+func writeFile(target string, m *member) (*Entry, error) {
+	src, err := m.open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	perm := m.mode.Perm()
+	if perm == 0 {
+		perm = 0644
+	}
+
+	// an existing symlink would be followed by open, replace it by a regular file
+	if stat, err := os.Lstat(target); err == nil && stat.Mode()&fs.ModeSymlink != 0 {
+		if err = os.Remove(target); err != nil {
+			return nil, err
+		}
+	}
+
+	dst, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return nil, err
+	}
+	defer dst.Close()
+
+	h := sha1.New()
+	size, err := io.Copy(io.MultiWriter(dst, h), src)
+	if err != nil {
+		return nil, err
+	}
+	if err = dst.Close(); err != nil {
+		return nil, err
+	}
+	// the mode passed to open is reduced by the umask
+	if err = os.Chmod(target, perm); err != nil {
+		return nil, err
+	}
+
+	return &Entry{
+		Size: size,
+		Mode: perm,
+		Hash: hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
@@ -0,0 +1,224 @@
+package extract
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/hex"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testFile is a member of an archive built by a test.
+type testFile struct {
+	name string
+	body string
+	mode fs.FileMode
+	// link is the target of symlinks and hard links.
+	link string
+}
+
+func writeTarGz(t *testing.T, name string, files []testFile) {
+	t.Helper()
+
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, file := range files {
+		hdr := &tar.Header{
+			Name:     file.name,
+			Mode:     int64(file.mode.Perm()),
+			Size:     int64(len(file.body)),
+			Typeflag: tar.TypeReg,
+		}
+		switch {
+		case file.mode.IsDir():
+			hdr.Typeflag = tar.TypeDir
+		case file.mode&fs.ModeSymlink != 0:
+			hdr.Typeflag = tar.TypeSymlink
+		case file.link != "":
+			hdr.Typeflag = tar.TypeLink
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			hdr.Size = 0
+			hdr.Linkname = file.link
+		}
+
+		if err = tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Size > 0 {
+			if _, err = tw.Write([]byte(file.body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err = tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeZip(t *testing.T, name string, files []testFile) {
+	t.Helper()
+
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	for _, file := range files {
+		hdr := &zip.FileHeader{Name: file.name, Method: zip.Deflate}
+		hdr.SetMode(file.mode)
+
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body := file.body
+		if file.mode&fs.ModeSymlink != 0 {
+			body = file.link
+		}
+		if _, err = w.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		archive string
+		files   []testFile
+		err     string
+	}{
+		{"zip parent", "evil.zip", []testFile{{name: "../evil", body: "x", mode: 0644}}, "escapes"},
+		{"zip nested parent", "evil.zip", []testFile{{name: "modules/../../evil", body: "x", mode: 0644}}, "escapes"},
+		{"zip backslash parent", "evil.zip", []testFile{{name: "..\\evil", body: "x", mode: 0644}}, "escapes"},
+		{"zip absolute", "evil.zip", []testFile{{name: "/tmp/evil", body: "x", mode: 0644}}, "escapes"},
+		{"zip symlink", "evil.zip", []testFile{{name: "evil", link: "/etc/passwd", mode: fs.ModeSymlink | 0777}}, "symlinks"},
+		{"tar parent", "evil.tar.gz", []testFile{{name: "../evil", body: "x", mode: 0644}}, "escapes"},
+		{"tar absolute", "evil.tar.gz", []testFile{{name: "/tmp/evil", body: "x", mode: 0644}}, "escapes"},
+		{"tar symlink", "evil.tar.gz", []testFile{{name: "evil", link: "../", mode: fs.ModeSymlink | 0777}}, "symlinks"},
+		{"tar hard link", "evil.tar.gz", []testFile{{name: "evil", link: "/etc/passwd", mode: 0644}}, "hard links"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			dir := filepath.Join(root, "server")
+			if err := os.Mkdir(dir, 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			archive := filepath.Join(dir, tt.archive)
+			if strings.HasSuffix(tt.archive, ".zip") {
+				writeZip(t, archive, tt.files)
+			} else {
+				writeTarGz(t, archive, tt.files)
+			}
+
+			entries, err := Extract(archive, dir)
+			if err == nil {
+				t.Fatalf("expected an error, extracted %d files", len(entries))
+			}
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected an error containing %q, got %v", tt.err, err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("expected no extracted files, got %d", len(entries))
+			}
+			for _, name := range []string{filepath.Join(root, "evil"), filepath.Join(dir, "evil")} {
+				if _, err := os.Lstat(name); err == nil {
+					t.Errorf("%s has been created", name)
+				}
+			}
+		})
+	}
+}
+
+func TestExtract(t *testing.T) {
+	files := []testFile{
+		{name: "modules/", mode: fs.ModeDir | 0750},
+		{name: "modules/libjs.so", body: "library", mode: 0644},
+		{name: "start.sh", body: "#!/bin/sh\n", mode: 0755},
+		{name: "server.toml", body: "secret", mode: 0600},
+	}
+	want := map[string]testFile{
+		"modules/libjs.so": files[1],
+		"start.sh":         files[2],
+		"server.toml":      files[3],
+	}
+
+	for _, archive := range []string{"module.zip", "module.tar.gz"} {
+		t.Run(archive, func(t *testing.T) {
+			dir := t.TempDir()
+			name := filepath.Join(dir, archive)
+			if strings.HasSuffix(archive, ".zip") {
+				writeZip(t, name, files)
+			} else {
+				writeTarGz(t, name, files)
+			}
+
+			entries, err := Extract(name, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != len(want) {
+				t.Fatalf("expected %d extracted files, got %d", len(want), len(entries))
+			}
+
+			for _, entry := range entries {
+				file, ok := want[entry.Name]
+				if !ok {
+					t.Errorf("unexpected file %s", entry.Name)
+					continue
+				}
+
+				sum := sha1.Sum([]byte(file.body))
+				if entry.Hash != hex.EncodeToString(sum[:]) || entry.Size != int64(len(file.body)) || entry.Mode != file.mode {
+					t.Errorf("unexpected entry %+v for %s", entry, file.name)
+				}
+
+				data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(entry.Name)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(data) != file.body {
+					t.Errorf("unexpected content of %s: %q", entry.Name, data)
+				}
+				stat, err := os.Stat(filepath.Join(dir, filepath.FromSlash(entry.Name)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if stat.Mode().Perm() != file.mode {
+					t.Errorf("expected mode %s of %s, got %s", file.mode, entry.Name, stat.Mode().Perm())
+				}
+			}
+
+			stat, err := os.Stat(filepath.Join(dir, "modules"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !stat.IsDir() || stat.Mode().Perm() != 0750 {
+				t.Errorf("expected directory modules with mode 0750, got %s", stat.Mode())
+			}
+		})
+	}
+}
@@ -11,8 +11,10 @@ var (
 	WarnLogger   *log.Logger
 	ErrLogger    *log.Logger
 	DebugLogger  *log.Logger
-	defaultFlags = log.Ldate | log.Ltime
-	debugFlags   = log.Ldate | log.Ltime | log.Lshortfile
+	defaultFlags           = log.Ldate | log.Ltime
+	debugFlags             = log.Ldate | log.Ltime | log.Lshortfile
+	output       io.Writer = os.Stdout
+	debugging    bool
 )
 
 func init() {
@@ -23,8 +25,9 @@ func init() {
 }
 
 func SetDebug(debug bool) {
+	debugging = debug
 	if debug {
-		DebugLogger.SetOutput(os.Stdout)
+		DebugLogger.SetOutput(output)
 		InfoLogger.SetFlags(debugFlags)
 		WarnLogger.SetFlags(debugFlags)
 		ErrLogger.SetFlags(debugFlags)
@@ -36,6 +39,16 @@ func SetDebug(debug bool) {
 	}
 }
 
+// SetOutput redirects the info, warn and debug logs, errors are always written to stderr.
+func SetOutput(w io.Writer) {
+	output = w
+	InfoLogger.SetOutput(w)
+	WarnLogger.SetOutput(w)
+	if debugging {
+		DebugLogger.SetOutput(w)
+	}
+}
+
 func Disable() {
 	InfoLogger.SetOutput(io.Discard)
 	WarnLogger.SetOutput(io.Discard)
@@ -0,0 +1,37 @@
+package mirror
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// NewTransport returns a transport which serves requests from the local directory dir instead of the network.
+// The url path of a request is resolved inside dir regardless of its host, so dir mirrors the paths of the cdn,
+// e.g. https://cdn.alt-mp.com/server/release/x64_linux/update.json is read from dir/server/release/x64_linux/update.json.
+// Missing files are answered with 404. If dir is empty, every request fails, which keeps offline runs off the network.
+func NewTransport(dir string) http.RoundTripper {
+	if dir == "" {
+		return offlineTransport{}
+	}
+	return &transport{files: http.NewFileTransport(http.Dir(dir))}
+}
+
+type transport struct {
+	files http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return nil, fmt.Errorf("offline: %s %s is not supported by the mirror", req.Method, req.URL)
+	}
+	return t.files.RoundTrip(req)
+}
+
+type offlineTransport struct{}
+
+func (offlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	return nil, fmt.Errorf("offline: %s is not available without a mirror", req.URL)
+}
@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/timo972/altv-cli/pkg/retry"
+)
+
+// maxBurst caps the bytes a limiter hands out at once, so the throughput stays smooth.
+const maxBurst = 64 << 10
+
+// Limiter is a token bucket limiting the combined throughput of all readers sharing it.
+// It is safe for concurrent use, a nil Limiter does not limit at all.
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  int
+	tokens float64
+	last   time.Time
+}
+
+// New returns a limiter allowing bytesPerSecond, nil if bytesPerSecond <= 0.
+func New(bytesPerSecond int64) *Limiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+
+	burst := int(min(bytesPerSecond, maxBurst))
+	return &Limiter{
+		rate:   float64(bytesPerSecond),
+		burst:  burst,
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait takes n bytes from the bucket and blocks until they are available or the context is done.
+// Waiting readers queue up behind each other, as every call reserves its bytes right away.
+func (l *Limiter) Wait(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(float64(l.burst), l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+	return retry.Sleep(ctx, delay)
+}
+
+type reader struct {
+	ctx      context.Context
+	r        io.Reader
+	limiters []*Limiter
+	chunk    int
+}
+
+// NewReader limits reads from r by all given limiters, nil limiters are ignored.
+func NewReader(ctx context.Context, r io.Reader, limiters ...*Limiter) io.Reader {
+	lr := &reader{ctx: ctx, r: r}
+	for _, l := range limiters {
+		if l == nil {
+			continue
+		}
+		if lr.chunk == 0 || l.burst < lr.chunk {
+			lr.chunk = l.burst
+		}
+		lr.limiters = append(lr.limiters, l)
+	}
+
+	if len(lr.limiters) == 0 {
+		return r
+	}
+	return lr
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if len(p) > r.chunk {
+		p = p[:r.chunk]
+	}
+
+	n, err := r.r.Read(p)
+	for _, l := range r.limiters {
+		if werr := l.Wait(r.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		rate    int64
+		wantNil bool
+		burst   int
+	}{
+		{0, true, 0},
+		{-1, true, 0},
+		{1 << 10, false, 1 << 10},
+		{10 << 20, false, maxBurst},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.rate)
+		if (l == nil) != tt.wantNil {
+			t.Fatalf("New(%d) = %v, want nil %v", tt.rate, l, tt.wantNil)
+		}
+		if l != nil && l.burst != tt.burst {
+			t.Errorf("New(%d) has burst %d, want %d", tt.rate, l.burst, tt.burst)
+		}
+	}
+
+	var l *Limiter
+	if err := l.Wait(context.Background(), 1<<30); err != nil {
+		t.Errorf("nil limiter: %v", err)
+	}
+}
+
+func TestReader(t *testing.T) {
+	const rate = 1 << 20
+	data := make([]byte, 320<<10)
+
+	tests := []struct {
+		name     string
+		limiters []*Limiter
+		min      time.Duration
+	}{
+		{"unlimited", []*Limiter{nil}, 0},
+		// the first burst is free, the rest takes (320K - 64K) / 1M
+		{"limited", []*Limiter{New(rate)}, 200 * time.Millisecond},
+		// the slower of two limiters decides
+		{"combined", []*Limiter{New(rate), New(10 * rate)}, 200 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			n, err := io.Copy(io.Discard, NewReader(context.Background(), bytes.NewReader(data), tt.limiters...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != int64(len(data)) {
+				t.Fatalf("read %d bytes, want %d", n, len(data))
+			}
+			if elapsed := time.Since(start); elapsed < tt.min || elapsed > tt.min+2*time.Second {
+				t.Errorf("took %s, want at least %s", elapsed, tt.min)
+			}
+		})
+	}
+}
+
+func TestReaderCanceled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := io.Copy(io.Discard, NewReader(ctx, bytes.NewReader(make([]byte, 1<<20)), New(64<<10)))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,159 @@
+// retry package containing the retry policy for transient http failures, shared by all cdns and the downloader.
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/timo972/altv-cli/pkg/logging"
+)
+
+type Policy struct {
+	// Retries is the number of retries after the first attempt, 0 disables retries.
+	Retries int
+	// MinDelay is the delay before the first retry, it doubles with every further retry.
+	MinDelay time.Duration
+	// MaxDelay caps the backoff and Retry-After delays.
+	MaxDelay time.Duration
+}
+
+var DefaultPolicy = Policy{
+	Retries:  3,
+	MinDelay: 500 * time.Millisecond,
+	MaxDelay: 30 * time.Second,
+}
+
+// DefaultClient retries transient failures of idempotent requests with the DefaultPolicy.
+var DefaultClient = &http.Client{
+	Transport: NewTransport(http.DefaultTransport, DefaultPolicy),
+}
+
+// Backoff returns the jittered delay before the given retry (starting at 1).
+func (p Policy) Backoff(retry int) time.Duration {
+	d := p.MinDelay
+	for i := 1; i < retry && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	d = min(d, p.MaxDelay)
+	if d <= 0 {
+		return 0
+	}
+	// equal jitter: at least half of the delay, so retries of concurrent downloads spread out
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// Sleep waits for the delay or until the context is done.
+func Sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Transient reports whether the error is a temporary network failure, e.g. a refused or dropped connection.
+func Transient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &netErr)
+}
+
+// TransientStatus reports whether the response status is worth retrying.
+func TransientStatus(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests,
+		http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// Transport retries idempotent requests on transient errors and responses.
+type Transport struct {
+	Base   http.RoundTripper
+	Policy Policy
+}
+
+func NewTransport(base http.RoundTripper, policy Policy) *Transport {
+	return &Transport{
+		Base:   base,
+		Policy: policy,
+	}
+}
+
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return req.Body == nil || req.Body == http.NoBody
+	default:
+		return false
+	}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.Base.RoundTrip(req)
+	if !idempotent(req) {
+		return resp, err
+	}
+
+	for retry := 1; retry <= t.Policy.Retries; retry++ {
+		var reason string
+		delay := t.Policy.Backoff(retry)
+		switch {
+		case err != nil && Transient(err):
+			reason = err.Error()
+		case err == nil && TransientStatus(resp.StatusCode):
+			reason = resp.Status
+			if after, ok := retryAfter(resp); ok {
+				delay = min(after, t.Policy.MaxDelay)
+			}
+		default:
+			return resp, err
+		}
+
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+		}
+
+		logging.DebugLogger.Printf("retrying %s %s in %s (%d/%d): %s", req.Method, req.URL, delay.Round(time.Millisecond), retry, t.Policy.Retries, reason)
+		if err := Sleep(req.Context(), delay); err != nil {
+			return nil, err
+		}
+
+		resp, err = t.Base.RoundTrip(req)
+	}
+
+	if err != nil && Transient(err) && t.Policy.Retries > 0 {
+		return nil, fmt.Errorf("giving up after %d retries: %w", t.Policy.Retries, err)
+	}
+	return resp, err
+}
+
+// retryAfter parses the Retry-After header, given in seconds or as http date.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
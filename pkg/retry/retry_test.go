@@ -0,0 +1,121 @@
+package retry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{"missing", "", 0, false},
+		{"seconds", "120", 2 * time.Minute, true},
+		{"zero seconds", "0", 0, true},
+		{"negative seconds", "-1", 0, false},
+		{"invalid", "soon", 0, false},
+		{"fractional seconds", "1.5", 0, false},
+		{"http date", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), time.Hour, true},
+		{"http date in the past", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{}}
+			if tt.header != "" {
+				resp.Header.Set("Retry-After", tt.header)
+			}
+
+			got, ok := retryAfter(resp)
+			if ok != tt.ok {
+				t.Fatalf("got ok %v, want %v", ok, tt.ok)
+			}
+			// http dates have a resolution of a second and are compared to the current time
+			if got > tt.want || got < tt.want-2*time.Second {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := Policy{Retries: 5, MinDelay: time.Second, MaxDelay: 5 * time.Second}
+
+	tests := []struct {
+		retry int
+		max   time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 5 * time.Second},
+		{10, 5 * time.Second},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			if d := p.Backoff(tt.retry); d < tt.max/2 || d > tt.max {
+				t.Fatalf("retry %d: got %s, want between %s and %s", tt.retry, d, tt.max/2, tt.max)
+			}
+		}
+	}
+
+	if d := (Policy{}).Backoff(1); d != 0 {
+		t.Errorf("got %s without delays, want 0", d)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		failures int32
+		retries  int
+		status   int
+		requests int32
+	}{
+		{"succeeds after transient failures", http.MethodGet, 2, 3, http.StatusOK, 3},
+		{"gives up after the retries", http.MethodGet, 5, 2, http.StatusServiceUnavailable, 3},
+		{"retries disabled", http.MethodGet, 1, 0, http.StatusServiceUnavailable, 1},
+		{"non idempotent request", http.MethodPost, 1, 3, http.StatusServiceUnavailable, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if requests.Add(1) <= tt.failures {
+					w.Header().Set("Retry-After", "0")
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+			}))
+			defer srv.Close()
+
+			client := &http.Client{
+				Transport: NewTransport(http.DefaultTransport, Policy{Retries: tt.retries, MinDelay: time.Hour, MaxDelay: time.Hour}),
+			}
+			req, err := http.NewRequest(tt.method, srv.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.status {
+				t.Errorf("got status %d, want %d", resp.StatusCode, tt.status)
+			}
+			if n := requests.Load(); n != tt.requests {
+				t.Errorf("got %d requests, want %d", n, tt.requests)
+			}
+		})
+	}
+}
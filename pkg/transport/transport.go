@@ -0,0 +1,140 @@
+// transport package building the http client shared by all cdns and the downloader.
+package transport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/timo972/altv-cli/pkg/retry"
+)
+
+// DefaultUserAgent is sent with every request, unless Config.UserAgent is set.
+var DefaultUserAgent = "altv-cli"
+
+type Config struct {
+	// CAFile is a PEM bundle of certificate authorities trusted in addition to the system ones, e.g. of an internal mirror.
+	CAFile string
+	// CertFile and KeyFile are the PEM encoded client certificate and key presented to servers requiring mutual TLS.
+	CertFile string
+	KeyFile  string
+	// Proxy is the url of the proxy all requests are sent through, the environment (HTTPS_PROXY, NO_PROXY, ...) is used if empty.
+	Proxy string
+	// UserAgent replaces DefaultUserAgent.
+	UserAgent string
+	// ConnectTimeout limits establishing a connection including the TLS handshake, 0 uses the default of net/http.
+	ConnectTimeout time.Duration
+	// IdleTimeout closes connections idle for longer, 0 uses the default of net/http.
+	IdleTimeout time.Duration
+	// Retry is the policy transient failures are retried with.
+	Retry retry.Policy
+}
+
+// New returns a client configured by cfg, which retries transient failures of idempotent requests.
+func New(cfg Config) (*http.Client, error) {
+	base, err := NewTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ua := cfg.UserAgent
+	if ua == "" {
+		ua = DefaultUserAgent
+	}
+
+	return &http.Client{
+		Transport: retry.NewTransport(&userAgent{base: base, value: ua}, cfg.Retry),
+	}, nil
+}
+
+// NewTransport returns the http transport configured by cfg, without retries and user agent.
+func NewTransport(cfg Config) (*http.Transport, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+
+	if cfg.Proxy != "" {
+		proxy, err := url.Parse(cfg.Proxy)
+		if err != nil || proxy.Host == "" {
+			return nil, fmt.Errorf("invalid proxy url %q", cfg.Proxy)
+		}
+		t.Proxy = http.ProxyURL(proxy)
+	}
+
+	if cfg.ConnectTimeout > 0 {
+		dialer := &net.Dialer{
+			Timeout:   cfg.ConnectTimeout,
+			KeepAlive: 30 * time.Second,
+		}
+		t.DialContext = dialer.DialContext
+		t.TLSHandshakeTimeout = cfg.ConnectTimeout
+	}
+	if cfg.IdleTimeout > 0 {
+		t.IdleConnTimeout = cfg.IdleTimeout
+	}
+
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		t.TLSClientConfig = tlsConfig
+	}
+
+	return t, nil
+}
+
+// newTLSConfig loads the certificate authorities and client certificate, nil if none are configured.
+func newTLSConfig(cfg Config) (*tls.Config, error) {
+	if cfg.CAFile == "" && cfg.CertFile == "" && cfg.KeyFile == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read ca file: %w", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in ca file %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		if cfg.CertFile == "" || cfg.KeyFile == "" {
+			return nil, fmt.Errorf("client certificate and key have to be set together")
+		}
+
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// userAgent sets the User-Agent header of every request, replacing the one of client libraries like go-github.
+type userAgent struct {
+	base  http.RoundTripper
+	value string
+}
+
+func (t *userAgent) RoundTrip(req *http.Request) (*http.Response, error) {
+	// a RoundTripper must not modify the request
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.value)
+	return t.base.RoundTrip(req)
+}
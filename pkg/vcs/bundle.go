@@ -0,0 +1,237 @@
+package vcs
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/timo972/altv-cli/pkg/cache"
+	"github.com/timo972/altv-cli/pkg/cdn"
+	"github.com/timo972/altv-cli/pkg/logging"
+	"github.com/timo972/altv-cli/pkg/platform"
+	"github.com/timo972/altv-cli/pkg/version"
+)
+
+// BundleVersion is the version of the bundle format written by ExportBundle.
+const BundleVersion = 1
+
+const (
+	// bundleIndexName is the first entry of a bundle, it describes the modules the bundle holds.
+	bundleIndexName = "bundle.json"
+	// bundleObjectsDir holds the files of a bundle, named by their sha1 hash.
+	bundleObjectsDir = "objects/"
+)
+
+// BundleModule is a module of a bundle, resolved for one branch and arch.
+type BundleModule struct {
+	CDN      string         `json:"cdn"`
+	Branch   version.Branch `json:"branch"`
+	Arch     platform.Arch  `json:"arch"`
+	Module   string         `json:"module"`
+	Manifest *cdn.Manifest  `json:"manifest"`
+	Files    []*cdn.File    `json:"files"`
+}
+
+// BundleIndex describes the modules of a bundle.
+type BundleIndex struct {
+	Version int             `json:"version"`
+	Created time.Time       `json:"created"`
+	Modules []*BundleModule `json:"modules"`
+}
+
+// ExportBundle resolves the modules for every branch and arch, downloads their files and writes them together with their manifests into a tar archive.
+// The archive starts with the index, followed by every file once, so it can be imported into the cache of an air-gapped host with ImportBundle.
+func ExportBundle(ctx context.Context, w io.Writer, branches []version.Branch, arches []platform.Arch, modules []string, reg CDNRegistry, opts ...Option) (*BundleIndex, error) {
+	staging, err := os.MkdirTemp("", "altv-bundle-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+
+	index := &BundleIndex{
+		Version: BundleVersion,
+		Created: time.Now().UTC(),
+		Modules: make([]*BundleModule, 0),
+	}
+	// objects maps the hash of every file to its downloaded copy
+	objects := make(map[string]string)
+	order := make([]string, 0)
+
+	for _, branch := range branches {
+		for _, arch := range arches {
+			dir := filepath.Join(staging, fmt.Sprintf("%s-%s", branch, arch))
+			d := NewDownloader(arch, branch, modules, reg, opts...).(*downloader)
+
+			mods, err := d.resolveModules(ctx, false)
+			if err != nil {
+				return nil, fmt.Errorf("unable to resolve modules for %s/%s: %w", branch, arch, err)
+			}
+
+			files := make([]*cdn.File, 0)
+			for _, mod := range mods {
+				for _, file := range mod.files {
+					if file.Hash == "" {
+						return nil, fmt.Errorf("no checksum for %s of module %s, it can not be bundled", file.Name, mod.module)
+					}
+					files = append(files, file)
+				}
+				index.Modules = append(index.Modules, &BundleModule{
+					CDN:      mod.cdn.Name(),
+					Branch:   branch,
+					Arch:     arch,
+					Module:   mod.module,
+					Manifest: mod.manifest,
+					Files:    mod.files,
+				})
+			}
+
+			logging.InfoLogger.Printf("downloading %d files for %s/%s", len(files), branch, arch)
+			if err = d.downloadFiles(ctx, dir, files, nil); err != nil {
+				return nil, err
+			}
+
+			for _, file := range files {
+				if _, ok := objects[file.Hash]; ok {
+					continue
+				}
+				name, err := resolvePath(dir, file.Name)
+				if err != nil {
+					return nil, err
+				}
+				objects[file.Hash] = name
+				order = append(order, file.Hash)
+			}
+		}
+	}
+
+	tw := tar.NewWriter(w)
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err = tw.WriteHeader(&tar.Header{
+		Name:    bundleIndexName,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: index.Created,
+	}); err != nil {
+		return nil, err
+	}
+	if _, err = tw.Write(data); err != nil {
+		return nil, err
+	}
+
+	for _, hash := range order {
+		if err = writeBundleObject(tw, hash, objects[hash], index.Created); err != nil {
+			return nil, err
+		}
+	}
+
+	return index, tw.Close()
+}
+
+func writeBundleObject(tw *tar.Writer, hash string, name string, modTime time.Time) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	if err = tw.WriteHeader(&tar.Header{
+		Name:    bundleObjectsDir + hash,
+		Mode:    0644,
+		Size:    stat.Size(),
+		ModTime: modTime,
+	}); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// ImportBundle verifies every file of the bundle against its hash and loads it into the cache together with the manifests of the bundled modules,
+// so they can be installed offline. The manifests are only recorded once all files of the bundle are cached.
+func ImportBundle(r io.Reader, c cache.Cache) (*BundleIndex, error) {
+	tr := tar.NewReader(r)
+
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read bundle: %w", err)
+	}
+	if hdr.Name != bundleIndexName {
+		return nil, fmt.Errorf("not a bundle, expected %s as first entry but got %s", bundleIndexName, hdr.Name)
+	}
+
+	var index BundleIndex
+	if err = json.NewDecoder(tr).Decode(&index); err != nil {
+		return nil, fmt.Errorf("broken bundle index: %w", err)
+	}
+	if index.Version != BundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d, expected %d", index.Version, BundleVersion)
+	}
+
+	for {
+		hdr, err = tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("unable to read bundle: %w", err)
+		}
+
+		hash, ok := strings.CutPrefix(hdr.Name, bundleObjectsDir)
+		if !ok || hdr.Typeflag != tar.TypeReg {
+			logging.WarnLogger.Printf("skipping unknown bundle entry %s", hdr.Name)
+			continue
+		}
+
+		logging.DebugLogger.Printf("importing %s", hash)
+		h := sha1.New()
+		if err = c.Put(hash, io.TeeReader(tr, h)); err != nil {
+			return nil, fmt.Errorf("invalid bundle entry %s: %w", hdr.Name, err)
+		}
+		// Put skips objects already cached without reading them, the entry is checked all the same
+		if _, err = io.Copy(h, tr); err != nil {
+			return nil, fmt.Errorf("unable to read bundle: %w", err)
+		}
+		if checksum := hex.EncodeToString(h.Sum(nil)); checksum != strings.ToLower(hash) {
+			return nil, fmt.Errorf("invalid bundle entry %s: checksum mismatch: expected %s, got %s", hdr.Name, hash, checksum)
+		}
+	}
+
+	missing := make([]string, 0)
+	for _, mod := range index.Modules {
+		for _, file := range mod.Files {
+			if !c.Has(file.Hash) {
+				missing = append(missing, fmt.Sprintf("%s/%s %s: %s", mod.Branch, mod.Arch, mod.Module, file.Name))
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("incomplete bundle, %d files are missing:\n  %s", len(missing), strings.Join(missing, "\n  "))
+	}
+
+	for _, mod := range index.Modules {
+		if err = c.PutRecord(recordKey("files", mod.CDN, mod.Branch, mod.Arch, mod.Module), mod.Files); err != nil {
+			return nil, err
+		}
+		if err = c.PutRecord(recordKey("manifest", mod.CDN, mod.Branch, mod.Arch, mod.Module), mod.Manifest); err != nil {
+			return nil, err
+		}
+	}
+
+	return &index, nil
+}
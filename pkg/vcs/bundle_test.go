@@ -0,0 +1,113 @@
+package vcs
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/timo972/altv-cli/pkg/cache"
+	"github.com/timo972/altv-cli/pkg/cdn"
+)
+
+// bundleEntry is an object of a test bundle, stored under the hash regardless of its content.
+type bundleEntry struct {
+	hash    string
+	content string
+}
+
+func writeBundle(t *testing.T, index *BundleIndex, entries []bundleEntry) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+
+	data, err := json.Marshal(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := func(name string, data []byte) {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(bundleIndexName, data)
+	for _, entry := range entries {
+		write(bundleObjectsDir+entry.hash, []byte(entry.content))
+	}
+
+	if err = tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestImportBundle(t *testing.T) {
+	server, js := sha1Hex("server"), sha1Hex("js")
+	index := &BundleIndex{
+		Version: BundleVersion,
+		Modules: []*BundleModule{{
+			CDN:      "altcdn",
+			Branch:   "release",
+			Arch:     "x64_linux",
+			Module:   "server",
+			Manifest: &cdn.Manifest{Version: "16.0.1", HashList: map[string]string{"altv-server": server, "modules/js-module.so": js}},
+			Files: []*cdn.File{
+				{Type: cdn.ModuleFile, Module: "server", Name: "altv-server", Hash: server, Size: 6},
+				{Type: cdn.ModuleFile, Module: "server", Name: "modules/js-module.so", Hash: js, Size: 2},
+			},
+		}},
+	}
+
+	tests := []struct {
+		name    string
+		version int
+		// cached are the entries put into the cache before the import.
+		cached  []bundleEntry
+		entries []bundleEntry
+		wantErr bool
+	}{
+		{"complete bundle", BundleVersion, nil, []bundleEntry{{server, "server"}, {js, "js"}}, false},
+		{"tampered entry", BundleVersion, nil, []bundleEntry{{server, "tampered"}, {js, "js"}}, true},
+		{"tampered entry already cached", BundleVersion, []bundleEntry{{server, "server"}}, []bundleEntry{{server, "tampered"}, {js, "js"}}, true},
+		{"missing entry", BundleVersion, nil, []bundleEntry{{server, "server"}}, true},
+		{"unsupported version", BundleVersion + 1, nil, []bundleEntry{{server, "server"}, {js, "js"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := cache.New(t.TempDir())
+			for _, entry := range tt.cached {
+				if err := c.Put(entry.hash, strings.NewReader(entry.content)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			idx := *index
+			idx.Version = tt.version
+
+			_, err := ImportBundle(writeBundle(t, &idx, tt.entries), c)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			// the manifests are only recorded for a valid bundle, so nothing is installed offline from a broken one
+			var man cdn.Manifest
+			ok, err := c.GetRecord(recordKey("manifest", "altcdn", "release", "x64_linux", "server"), &man)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok == tt.wantErr {
+				t.Errorf("manifest recorded = %v, want %v", ok, !tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if man.Version != "16.0.1" || !c.Has(server) || !c.Has(js) {
+				t.Errorf("bundle not imported: manifest %+v", man)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package vcs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/timo972/altv-cli/pkg/cache"
+	"github.com/timo972/altv-cli/pkg/cdn"
+	"github.com/timo972/altv-cli/pkg/logging"
+	"github.com/timo972/altv-cli/pkg/platform"
+	"github.com/timo972/altv-cli/pkg/version"
+)
+
+// cachedRegistry hands out the cdns of the registry wrapped in cachedCDN.
+type cachedRegistry struct {
+	CDNRegistry
+	cache   cache.Cache
+	offline bool
+}
+
+func (r *cachedRegistry) moduleCDN(module string) (cdn.CDN, bool) {
+	c, ok := r.CDNRegistry.moduleCDN(module)
+	if !ok {
+		return nil, false
+	}
+	return &cachedCDN{CDN: c, cache: r.cache, offline: r.offline}, true
+}
+
+// cachedCDN records the manifests and files a cdn returns in the cache, so they can be resolved offline later on.
+// Offline the records are used first, the cdn itself is only asked if there is none, e.g. to read a local mirror.
+type cachedCDN struct {
+	cdn.CDN
+	cache   cache.Cache
+	offline bool
+}
+
+func (c *cachedCDN) key(kind string, branch version.Branch, arch platform.Arch, module string) string {
+	return recordKey(kind, c.Name(), branch, arch, module)
+}
+
+// recordKey identifies the manifest or files record of a module in the cache.
+func recordKey(kind string, cdnName string, branch version.Branch, arch platform.Arch, module string) string {
+	return strings.Join([]string{kind, cdnName, string(branch), string(arch), module}, "/")
+}
+
+func (c *cachedCDN) record(key string, v any) {
+	if err := c.cache.PutRecord(key, v); err != nil {
+		logging.WarnLogger.Printf("unable to cache %s: %v", key, err)
+	}
+}
+
+func (c *cachedCDN) Manifest(ctx context.Context, branch version.Branch, arch platform.Arch, module string) (*cdn.Manifest, error) {
+	key := c.key("manifest", branch, arch, module)
+	if !c.offline {
+		man, err := c.CDN.Manifest(ctx, branch, arch, module)
+		if err == nil {
+			c.record(key, man)
+		}
+		return man, err
+	}
+
+	var man cdn.Manifest
+	if ok, err := c.cache.GetRecord(key, &man); err != nil {
+		return nil, err
+	} else if ok {
+		logging.DebugLogger.Printf("using cached manifest of %s", module)
+		return &man, nil
+	}
+
+	rman, err := c.CDN.Manifest(ctx, branch, arch, module)
+	if err != nil {
+		return nil, fmt.Errorf("not available offline: %w", err)
+	}
+	return rman, nil
+}
+
+func (c *cachedCDN) Files(ctx context.Context, branch version.Branch, arch platform.Arch, module string, manifest bool) (*cdn.Manifest, []*cdn.File, error) {
+	key := c.key("files", branch, arch, module)
+	if !c.offline {
+		man, files, err := c.CDN.Files(ctx, branch, arch, module, manifest)
+		if err == nil {
+			c.record(c.key("manifest", branch, arch, module), man)
+			c.record(key, moduleFilesOnly(files))
+		}
+		return man, files, err
+	}
+
+	var files []*cdn.File
+	if ok, err := c.cache.GetRecord(key, &files); err != nil {
+		return nil, nil, err
+	} else if !ok {
+		man, files, err := c.CDN.Files(ctx, branch, arch, module, manifest)
+		if err != nil {
+			return nil, nil, fmt.Errorf("not available offline: %w", err)
+		}
+		return man, files, nil
+	}
+	logging.DebugLogger.Printf("using cached files of %s", module)
+
+	man, err := c.Manifest(ctx, branch, arch, module)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !manifest {
+		return man, files, nil
+	}
+
+	mfile, err := c.manifestFile(module, man)
+	if err != nil {
+		return nil, nil, err
+	}
+	return man, append([]*cdn.File{mfile}, files...), nil
+}
+
+// manifestFile puts the manifest into the cache and returns it as file, so it is installed like any other file without a cdn.
+func (c *cachedCDN) manifestFile(module string, man *cdn.Manifest) (*cdn.File, error) {
+	data, err := json.Marshal(man)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha1.Sum(data)
+	hash := hex.EncodeToString(sum[:])
+	if err = c.cache.Put(hash, bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("unable to cache manifest of %s: %w", module, err)
+	}
+
+	return &cdn.File{
+		Type:   cdn.ModuleManifestFile,
+		Module: module,
+		Name:   cdn.ManifestFileName(module),
+		Hash:   hash,
+		Size:   len(data),
+	}, nil
+}
+
+// moduleFilesOnly drops the manifest file, which is rebuilt from the cached manifest.
+func moduleFilesOnly(files []*cdn.File) []*cdn.File {
+	mfiles := make([]*cdn.File, 0, len(files))
+	for _, file := range files {
+		if file.Type == cdn.ModuleFile {
+			mfiles = append(mfiles, file)
+		}
+	}
+	return mfiles
+}
@@ -0,0 +1,145 @@
+package vcs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/timo972/altv-cli/pkg/cache"
+	"github.com/timo972/altv-cli/pkg/cdn"
+	"github.com/timo972/altv-cli/pkg/mirror"
+	"github.com/timo972/altv-cli/pkg/platform"
+	"github.com/timo972/altv-cli/pkg/version"
+)
+
+// fakeCDN serves a single manifest and file list, or fails with err.
+type fakeCDN struct {
+	man   *cdn.Manifest
+	files []*cdn.File
+	err   error
+}
+
+func (c *fakeCDN) Name() string           { return "fake" }
+func (c *fakeCDN) Has(module string) bool { return true }
+
+func (c *fakeCDN) Manifest(context.Context, version.Branch, platform.Arch, string) (*cdn.Manifest, error) {
+	return c.man, c.err
+}
+
+func (c *fakeCDN) Files(_ context.Context, _ version.Branch, _ platform.Arch, module string, manifest bool) (*cdn.Manifest, []*cdn.File, error) {
+	if c.err != nil {
+		return nil, nil, c.err
+	}
+	if !manifest {
+		return c.man, c.files, nil
+	}
+	return c.man, append([]*cdn.File{{Type: cdn.ModuleManifestFile, Module: module, Name: cdn.ManifestFileName(module)}}, c.files...), nil
+}
+
+func TestCachedCDNOffline(t *testing.T) {
+	man := &cdn.Manifest{
+		BuildNumber: 1234,
+		Version:     "16.0.1",
+		HashList:    map[string]string{"altv-server": sha1Hex("server")},
+		SizeList:    map[string]int{"altv-server": 6},
+	}
+	files := []*cdn.File{{Type: cdn.ModuleFile, Module: "server", Name: "altv-server", Url: "https://cdn/altv-server", Hash: sha1Hex("server"), Size: 6}}
+	unreachable := &fakeCDN{err: errors.New("no network")}
+	ctx := context.Background()
+
+	c := cache.New(t.TempDir())
+	online := &cachedCDN{CDN: &fakeCDN{man: man, files: files}, cache: c}
+	// resolving the files records their manifest as well
+	if _, _, err := online.Files(ctx, "release", "x64_linux", "server", true); err != nil {
+		t.Fatal(err)
+	}
+
+	offline := &cachedCDN{CDN: unreachable, cache: c, offline: true}
+	got, err := offline.Manifest(ctx, "release", "x64_linux", "server")
+	if err != nil || got.BuildNumber != man.BuildNumber || got.Version != man.Version {
+		t.Fatalf("got cached manifest %+v, %v", got, err)
+	}
+
+	fman, list, err := offline.Files(ctx, "release", "x64_linux", "server", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fman == nil || fman.Version != man.Version || len(list) != 2 || list[0].Type != cdn.ModuleManifestFile || *list[1] != *files[0] {
+		t.Fatalf("got cached files %+v", list)
+	}
+
+	// the manifest is installed from the cache, it has no url
+	dst := filepath.Join(t.TempDir(), "manifest")
+	if ok, err := c.Get(list[0].Hash, dst); err != nil || !ok {
+		t.Fatalf("manifest not cached: %v, %v", ok, err)
+	}
+	data, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cached cdn.Manifest
+	if err = json.Unmarshal(data, &cached); err != nil || cached.Version != man.Version {
+		t.Errorf("got cached manifest file %s, %v", data, err)
+	}
+
+	// other modules were never resolved online
+	other := &cachedCDN{CDN: unreachable, cache: c, offline: true}
+	if _, err = other.Manifest(ctx, "release", "x64_linux", "js-module"); err == nil || !strings.Contains(err.Error(), "not available offline") {
+		t.Errorf("got %v, want not available offline", err)
+	}
+}
+
+func TestDownloadFilesOffline(t *testing.T) {
+	c := cache.New(t.TempDir())
+	if err := c.Put(sha1Hex("server"), strings.NewReader("server")); err != nil {
+		t.Fatal(err)
+	}
+	mirrorDir := t.TempDir()
+	writeTree(t, mirrorDir, map[string]string{"js-module/libjs-module.so": "js"})
+
+	cached := &cdn.File{Module: "server", Name: "altv-server", Url: "https://cdn.example/server/altv-server", Hash: sha1Hex("server"), Size: 6}
+	mirrored := &cdn.File{Module: "js-module", Name: "modules/libjs-module.so", Url: "https://cdn.example/js-module/libjs-module.so", Hash: sha1Hex("js"), Size: 2}
+	missing := &cdn.File{Module: "voice", Name: "modules/voice.so", Url: "https://cdn.example/voice/voice.so", Hash: sha1Hex("voice"), Size: 5}
+
+	tests := []struct {
+		name    string
+		files   []*cdn.File
+		missing []*cdn.File
+	}{
+		{"from cache and mirror", []*cdn.File{cached, mirrored}, nil},
+		{"missing files", []*cdn.File{cached, mirrored, missing}, []*cdn.File{missing}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &http.Client{Transport: mirror.NewTransport(mirrorDir)}
+			d := newTestDownloader(WithCache(c), WithOffline(), WithHTTPClient(client))
+
+			dir := t.TempDir()
+			err := d.downloadFiles(context.Background(), dir, tt.files, nil)
+			if len(tt.missing) > 0 {
+				var m *errMissing
+				if !errors.As(err, &m) || len(m.files) != len(tt.missing) || m.files[0] != tt.missing[0] {
+					t.Fatalf("got %v, want %d missing files", err, len(tt.missing))
+				}
+				if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+					t.Errorf("files installed although some are missing: %v", entries)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := readTree(t, dir)
+			if got["altv-server"] != "server" || got["modules/libjs-module.so"] != "js" {
+				t.Errorf("got %v", got)
+			}
+		})
+	}
+}
@@ -1,37 +1,103 @@
 package vcs
 
 import (
+	"net/http"
+
+	"github.com/timo972/altv-cli/pkg/auth"
 	"github.com/timo972/altv-cli/pkg/cdn"
 	"github.com/timo972/altv-cli/pkg/cdn/altcdn"
+	"github.com/timo972/altv-cli/pkg/logging"
+	"github.com/timo972/altv-cli/pkg/retry"
 )
 
 var DefaultRegistry CDNRegistry = NewRegistry(altcdn.Default)
 
 type CDNRegistry interface {
+	// AddCDN adds the cdn, it takes precedence over the cdns added before for the modules it hosts.
 	AddCDN(cdn.CDN)
+	// SetHTTPClient sets the client shared by all cdns of the registry and the downloads from them.
+	SetHTTPClient(*http.Client)
+	// SetCredentials authenticates the manifest and file requests to the cdn with the given name, nil removes them.
+	// Credentials can be set before the cdn is added, a warning is logged as they are unused until then.
+	SetCredentials(name string, creds *auth.Credentials)
 	moduleCDN(module string) (cdn.CDN, bool)
+	// cdnClient returns the client of the cdn with the given name, including its credentials.
+	cdnClient(name string) *http.Client
+}
+
+// clientSetter is implemented by cdns whose http client can be replaced.
+type clientSetter interface {
+	SetHTTPClient(*http.Client)
 }
 
 type cdnRegistry struct {
-	cdns []cdn.CDN
+	cdns   []cdn.CDN
+	client *http.Client
+	creds  map[string]*auth.Credentials
 }
 
 func NewRegistry(cdns ...cdn.CDN) CDNRegistry {
 	return &cdnRegistry{
-		cdns: cdns,
+		cdns:   cdns,
+		client: retry.DefaultClient,
+		creds:  make(map[string]*auth.Credentials),
 	}
 }
 
-// getCDN returns the CDN that hosts the given module.
+// moduleCDN returns the CDN that hosts the given module, the one added last if several do.
 func (r *cdnRegistry) moduleCDN(module string) (cdn.CDN, bool) {
-	for _, cdn := range r.cdns {
-		if cdn.Has(module) {
-			return cdn, true
+	for i := len(r.cdns) - 1; i >= 0; i-- {
+		if r.cdns[i].Has(module) {
+			return r.cdns[i], true
 		}
 	}
 	return nil, false
 }
 
+// AddCDN adds the cdn and hands it the client set by SetHTTPClient.
 func (r *cdnRegistry) AddCDN(cdn cdn.CDN) {
 	r.cdns = append(r.cdns, cdn)
+	r.setClient(cdn)
+}
+
+func (r *cdnRegistry) SetHTTPClient(client *http.Client) {
+	r.client = client
+	for _, cdn := range r.cdns {
+		r.setClient(cdn)
+	}
+}
+
+func (r *cdnRegistry) SetCredentials(name string, creds *auth.Credentials) {
+	if creds.Empty() {
+		delete(r.creds, name)
+	} else {
+		logging.DebugLogger.Printf("authenticating requests to %s with %s", name, creds)
+		r.creds[name] = creds
+	}
+
+	found := false
+	for _, cdn := range r.cdns {
+		if cdn.Name() == name {
+			r.setClient(cdn)
+			found = true
+		}
+	}
+	if !found && !creds.Empty() {
+		logging.WarnLogger.Printf("no cdn named %s, its credentials are unused", name)
+	}
+}
+
+func (r *cdnRegistry) setClient(cdn cdn.CDN) {
+	if c, ok := cdn.(clientSetter); ok {
+		c.SetHTTPClient(r.cdnClient(cdn.Name()))
+	} else if _, ok := r.creds[cdn.Name()]; ok {
+		logging.WarnLogger.Printf("cdn %s does not support credentials", cdn.Name())
+	}
+}
+
+func (r *cdnRegistry) cdnClient(name string) *http.Client {
+	if creds, ok := r.creds[name]; ok {
+		return auth.Client(r.client, creds)
+	}
+	return r.client
 }
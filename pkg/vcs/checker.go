@@ -2,15 +2,13 @@ package vcs
 
 import (
 	"context"
-	"crypto/sha1"
-	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/timo972/altv-cli/pkg/cdn"
@@ -39,6 +37,27 @@ func (status ModuleStatus) Has(s ModuleStatus) bool {
 
 type ModuleStatusResult map[string]ModuleStatus
 
+// Invalid returns the modules with missing or corrupted files, sorted.
+func (r ModuleStatusResult) Invalid() []string {
+	return r.filter(StatusInvalid)
+}
+
+// Upgradable returns the modules with a newer remote version, sorted.
+func (r ModuleStatusResult) Upgradable() []string {
+	return r.filter(StatusUpgradable)
+}
+
+func (r ModuleStatusResult) filter(s ModuleStatus) []string {
+	mods := make([]string, 0)
+	for mod, status := range r {
+		if status.Has(s) {
+			mods = append(mods, mod)
+		}
+	}
+	sort.Strings(mods)
+	return mods
+}
+
 type extManifest struct {
 	*cdn.Manifest
 	mod string
@@ -46,6 +65,8 @@ type extManifest struct {
 
 type Checker interface {
 	Verify(ctx context.Context, path string, remote bool) (ModuleStatusResult, error)
+	// Report verifies the installation like Verify and returns the state of every file.
+	Report(ctx context.Context, path string, remote bool) (Report, error)
 	AddCDN(cdn.CDN)
 }
 
@@ -54,49 +75,64 @@ type checker struct {
 	arch    platform.Arch
 	branch  version.Branch
 	modules []string
+	opts    options
 }
 
-func NewChecker(arch platform.Arch, branch version.Branch, modules []string, registry CDNRegistry) Checker {
+func NewChecker(arch platform.Arch, branch version.Branch, modules []string, registry CDNRegistry, opts ...Option) Checker {
+	o := newOptions(opts)
 	return &checker{
-		CDNRegistry: registry,
+		CDNRegistry: o.registry(registry),
 		arch:        arch,
 		branch:      branch,
 		modules:     modules,
+		opts:        o,
 	}
 }
 
-// TODO: utilize goroutines to aggregate manifests simultaneously
-func (c *checker) aggregateRemoteManifests() ([]*extManifest, error) {
-	allMans := make([]*extManifest, 0)
-	errs := make([]error, 0)
-	for _, mod := range c.modules {
-		cdn, ok := c.moduleCDN(mod)
-		if !ok {
-			err := newErrNoCDN(mod)
-			logging.WarnLogger.Printf(err.Error())
-			errs = append(errs, err)
-			continue
+// aggregateRemoteManifests fetches the manifests of all modules concurrently, bounded by the download concurrency.
+// Modules without manifest are skipped and their errors joined, both in the order of the modules.
+func (c *checker) aggregateRemoteManifests(ctx context.Context) ([]*extManifest, error) {
+	fetched := make([]*extManifest, len(c.modules))
+	errs := make([]error, len(c.modules))
+	forEach(ctx, len(c.modules), c.opts.concurrency, func(i int) {
+		fetched[i], errs[i] = c.remoteManifest(ctx, c.modules[i])
+		if errs[i] != nil {
+			logging.WarnLogger.Printf(errs[i].Error())
 		}
-		logging.DebugLogger.Printf("cdn %v for module %s", cdn, mod)
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
-		man, err := cdn.Manifest(c.branch, c.arch, mod)
-		if err != nil {
-			err = newErrNoManifest(mod, err)
-			logging.WarnLogger.Printf(err.Error())
-			errs = append(errs, err)
-			continue
+	allMans := make([]*extManifest, 0, len(fetched))
+	for _, man := range fetched {
+		if man != nil {
+			allMans = append(allMans, man)
 		}
-
-		logging.DebugLogger.Printf("got manifest for module %s", mod)
-		allMans = append(allMans, &extManifest{
-			Manifest: man,
-			mod:      mod,
-		})
 	}
 	return allMans, errors.Join(errs...)
 }
 
-func (c *checker) aggregateLocalManifests(path string) ([]*extManifest, []string, error) {
+func (c *checker) remoteManifest(ctx context.Context, mod string) (*extManifest, error) {
+	cdn, ok := c.moduleCDN(mod)
+	if !ok {
+		return nil, newErrNoCDN(mod)
+	}
+	logging.DebugLogger.Printf("cdn %v for module %s", cdn, mod)
+
+	man, err := cdn.Manifest(ctx, c.branch, c.arch, mod)
+	if err != nil {
+		return nil, newErrNoManifest(mod, err)
+	}
+
+	logging.DebugLogger.Printf("got manifest for module %s", mod)
+	return &extManifest{
+		Manifest: man,
+		mod:      mod,
+	}, nil
+}
+
+func aggregateLocalManifests(path string) ([]*extManifest, []string, error) {
 	mans := make([]*extManifest, 0)
 	mods := make([]string, 0)
 
@@ -107,11 +143,15 @@ func (c *checker) aggregateLocalManifests(path string) ([]*extManifest, []string
 
 		logging.DebugLogger.Printf("walking path %s", path)
 
+		if d.IsDir() && d.Name() == StateDir {
+			return filepath.SkipDir
+		}
+
 		if d.IsDir() {
 			return nil
 		}
 
-		if !strings.HasSuffix(d.Name(), ".update.json") {
+		if !strings.HasSuffix(d.Name(), cdn.ManifestFileSuffix) {
 			return nil
 		}
 
@@ -126,7 +166,7 @@ func (c *checker) aggregateLocalManifests(path string) ([]*extManifest, []string
 			return err
 		}
 
-		mod := strings.TrimSuffix(d.Name(), ".update.json")
+		mod := strings.TrimSuffix(d.Name(), cdn.ManifestFileSuffix)
 		mans = append(mans, &extManifest{
 			Manifest: &man,
 			mod:      mod,
@@ -138,82 +178,48 @@ func (c *checker) aggregateLocalManifests(path string) ([]*extManifest, []string
 	return mans, mods, err
 }
 
-func (c *checker) verifyWithManifest(path string, man *extManifest) (ModuleStatus, error) {
-	// logging.DebugLogger.Printf("verify using manifest: %+v", man)
-	status := StatusValid
-	for fname, fhash := range man.HashList {
-		if err := VerifyFileChecksum(path, fname, fhash, man.SizeList[fname]); err != nil {
-			status = StatusInvalid
-		}
+// InstalledModules returns the modules with a local manifest in the installation at path, none if the path does not exist.
+func InstalledModules(path string) ([]string, error) {
+	_, mods, err := aggregateLocalManifests(path)
+	if errors.Is(err, fs.ErrNotExist) && len(mods) == 0 {
+		return nil, nil
 	}
-	return status, nil
+	return mods, err
 }
 
-type moduleStatusResp struct {
-	err  error
-	stat ModuleStatus
-	mod  string
-}
-
-func (c *checker) verifyWithManifests(ctx context.Context, path string, mans []*extManifest) (ModuleStatusResult, error) {
-	msrch := make(chan *moduleStatusResp, len(mans))
-	for i, man := range mans {
-		go func(man *extManifest, i int) {
-			logging.DebugLogger.Printf("start module verify: %s", c.modules[i])
-			stat, err := c.verifyWithManifest(path, man)
-			logging.DebugLogger.Printf("got module status: %s %+v", c.modules[i], stat)
-			msrch <- &moduleStatusResp{
-				stat: stat,
-				err:  err,
-				mod:  man.mod,
-			}
-		}(man, i)
-	}
-
-	var err error
-	i := 0
-	msrs := ModuleStatusResult{}
-	for {
-		if i >= len(mans) {
-			logging.DebugLogger.Printf("%d manifests done!", len(mans))
-			break
-		}
-
-		select {
-		case msr := <-msrch:
-			logging.DebugLogger.Printf("received module status: %d %+v", i, msr)
-			if msr.err != nil && err != nil {
-				err = errors.Join(err, msr.err)
-			} else if msr.err != nil {
-				err = msr.err
-			}
+func (c *checker) verifyWithManifests(ctx context.Context, path string, mans []*extManifest) (Report, error) {
+	reports := make([]*ModuleReport, len(mans))
+	forEach(ctx, len(mans), 0, func(i int) {
+		logging.DebugLogger.Printf("start module verify: %s", mans[i].mod)
+		reports[i] = verifyManifest(ctx, path, mans[i].mod, mans[i].Manifest, c.opts.observer)
+		logging.DebugLogger.Printf("got module status: %s %+v", mans[i].mod, reports[i].Status)
+		c.opts.observer.Observe(Event{Type: EventModuleDone, Module: mans[i].mod})
+	})
 
-			msrs[msr.mod] = msr.stat
-			i++
-		case <-ctx.Done():
-			return msrs, fmt.Errorf("verify canceled by context: %w", ctx.Err())
+	report := Report{}
+	for i, mr := range reports {
+		if mr != nil {
+			report[mans[i].mod] = mr
 		}
 	}
+	if err := ctx.Err(); err != nil {
+		return report, fmt.Errorf("verify canceled by context: %w", err)
+	}
 
-	return msrs, err
+	logging.DebugLogger.Printf("%d manifests done!", len(mans))
+	return report, nil
 }
 
-// func (c *checker) processLocalManifests(ctx context.Context, path string, mans []*extManifest) (ModuleStatusResult, error) {
-// 	status, err := c.verifyWithManifests(ctx, path, mans)
-// 	if err != nil {
-// 		logging.WarnLogger.Printf("encountered errors while checking using local manifests: %v", err)
-// 	}
-// 	logging.DebugLogger.Printf("all module status: %+v", status)
-// 	return status, err
-// }
-
-// func (c *checker) processRemoteManifests(ctx context.Context, path string, rmans []*extManifest) (ModuleStatusResult, error) {
-// 	status, err := c.verifyWithManifests(ctx, path, rmans)
-// 	return nil, nil
-// }
-
 func (c *checker) Verify(ctx context.Context, path string, remote bool) (ModuleStatusResult, error) {
-	lmans, mods, err := c.aggregateLocalManifests(path)
+	report, err := c.Report(ctx, path, remote)
+	if report == nil {
+		return nil, err
+	}
+	return report.Status(), err
+}
+
+func (c *checker) Report(ctx context.Context, path string, remote bool) (Report, error) {
+	lmans, mods, err := aggregateLocalManifests(path)
 	if err != nil && len(lmans) < 1 {
 		return nil, err
 	} else if err != nil {
@@ -230,16 +236,18 @@ func (c *checker) Verify(ctx context.Context, path string, remote bool) (ModuleS
 	// logic:
 	// if no local manifests are found and remote = false: throw error
 	// if local manifests are found and remote = false: only check with local
-	// if local manifests are found and remote = true: first check with local, then for updates using remote
+	// if local manifests are found and remote = true: first check with local, then compare local and remote manifests for updates
 	// if no local manifests are found and remote = true: check with remote
+	// modules whose remote manifest is unavailable are skipped, resulting in a partial error
 
 	var rmans []*extManifest
 	if remote {
-		rmans, err = c.aggregateRemoteManifests()
+		rmans, err = c.aggregateRemoteManifests(ctx)
 		if err != nil && len(rmans) < 1 {
 			return nil, err
 		} else if err != nil {
 			logging.WarnLogger.Printf("encountered errors while looking for remote module manifests: %v", err)
+			err = newErrPartial(err)
 		}
 	}
 
@@ -250,78 +258,40 @@ func (c *checker) Verify(ctx context.Context, path string, remote bool) (ModuleS
 		return c.verifyWithManifests(ctx, path, lmans)
 	case lmansFound && remote:
 		logging.DebugLogger.Printf("checking local and remote manifests")
-		lstatus, lerr := c.verifyWithManifests(ctx, path, lmans)
+		report, lerr := c.verifyWithManifests(ctx, path, lmans)
 		if lerr != nil {
-			err = errors.Join(err, lerr)
+			return report, errors.Join(err, lerr)
 		}
 		logging.DebugLogger.Printf("local manifests done!")
 
-		rstatus, rerr := c.verifyWithManifests(ctx, path, rmans)
-		if rerr != nil {
-			err = errors.Join(err, rerr)
+		rmanByMod := make(map[string]*cdn.Manifest, len(rmans))
+		for _, rman := range rmans {
+			rmanByMod[rman.mod] = rman.Manifest
 		}
-		logging.DebugLogger.Printf("remote manifests done!")
-
-		result := ModuleStatusResult{}
-		for mod, lstat := range lstatus {
-			if rstat, ok := rstatus[mod]; ok {
-				switch rstat {
-				case StatusInvalid:
-					result[mod] = lstat.Add(StatusUpgradable)
-				case StatusValid:
-					result[mod] = lstat.Add(StatusUpToDate)
-				default:
-					result[mod] = lstat.Add(rstat)
-				}
+
+		for _, lman := range lmans {
+			if rman, ok := rmanByMod[lman.mod]; ok {
+				markUpgradable(report[lman.mod], lman.Manifest, rman)
 			} else {
-				logging.DebugLogger.Printf("no remote status for %s", mod)
-				result[mod] = lstat
+				logging.DebugLogger.Printf("no remote manifest for %s", lman.mod)
 			}
 		}
 		logging.DebugLogger.Printf("merged status!")
-		return result, err
+		return report, err
 	case !lmansFound && remote:
-		return c.verifyWithManifests(ctx, path, rmans)
+		report, verr := c.verifyWithManifests(ctx, path, rmans)
+		if verr != nil {
+			return report, verr
+		}
+		return report, err
 	default:
 		return nil, fmt.Errorf("unexpected switch case")
 	}
 }
 
+// VerifyFileChecksum verifies existence, size and checksum of the file in the installation.
+// Files without checksum are only checked for their size.
 func VerifyFileChecksum(path, fname, fhash string, fsize int) error {
-	fpath := fmt.Sprintf("%s/%s", path, fname)
-	logging.DebugLogger.Printf("verifying file: %s", fpath)
-	file, err := os.OpenFile(fpath, os.O_RDONLY, 0644)
-	if err != nil {
-		logging.DebugLogger.Printf("error while verifying file: could not open %s", fpath)
-		return err
-	}
-	defer file.Close()
-
-	h := sha1.New()
-	if _, err := io.Copy(h, file); err != nil {
-		logging.DebugLogger.Printf("error while verifying file: could hash contents of %s", fpath)
-		return err
-	}
-
-	checksum := hex.EncodeToString((h.Sum(nil)))
-	if checksum != fhash {
-		logging.DebugLogger.Printf("checksum missmatch for %s: expected %s, got %s", fpath, fhash, checksum)
-		return fmt.Errorf("checksum missmatch for %s: expected %s, got %s", fpath, fhash, checksum)
-	}
-
-	if fsize < 0 {
-		return nil
-	}
-
-	stat, err := file.Stat()
-	if err != nil {
-		logging.DebugLogger.Printf("file size read errpr for %s", fpath)
-		return err
-	}
-	if stat.Size() != int64(fsize) {
-		logging.DebugLogger.Printf("file size missmatch for %s: expected %d, got %d", fpath, fsize, stat.Size())
-		return fmt.Errorf("file size missmatch for %s: expected %d, got %d", fpath, fsize, stat.Size())
-	}
-
-	return nil
+	_, err := CheckFile(path, fname, fhash, fsize)
+	return err
 }
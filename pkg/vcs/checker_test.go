@@ -0,0 +1,92 @@
+package vcs
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestInstalledModules(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []string
+	}{
+		{"fresh installation", nil, nil},
+		{
+			name: "installed modules",
+			files: map[string]string{
+				"altv-server":              "server",
+				"server.update.json":       "{}",
+				"js-module.update.json":    "{}",
+				".altv/snapshots/1/server": "old",
+				// manifests kept in a snapshot are not installed
+				".altv/snapshots/1/voice.update.json": "{}",
+			},
+			want: []string{"js-module", "server"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "server")
+			writeTree(t, path, tt.files)
+
+			got, err := InstalledModules(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyCanceled(t *testing.T) {
+	path := t.TempDir()
+	files := map[string]string{"altv-server": "server", "data/clothes.bin": "clothes", "data/vehmodels.bin": "vehmodels"}
+	writeTree(t, path, files)
+
+	mans := make([]*extManifest, 3)
+	for i, mod := range []string{"server", "data-files", "js-module"} {
+		mans[i] = &extManifest{Manifest: testManifest("16.0.1", 1001, files), mod: mod}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var returned atomic.Bool
+	var late atomic.Int32
+	obs := ObserverFunc(func(e Event) {
+		if returned.Load() {
+			late.Add(1)
+		}
+		if e.Type == EventFileVerified {
+			cancel()
+		}
+	})
+
+	c := NewChecker("x64_linux", "release", nil, NewRegistry(), WithObserver(obs)).(*checker)
+	report, err := c.verifyWithManifests(ctx, path, mans)
+	returned.Store(true)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want canceled", err)
+	}
+
+	for mod, mr := range report {
+		if len(mr.Files) >= len(files) {
+			t.Errorf("module %s: verified all %d files after the cancel", mod, len(mr.Files))
+		}
+	}
+
+	// nothing is verified in the background once the verify returned
+	time.Sleep(50 * time.Millisecond)
+	if n := late.Load(); n > 0 {
+		t.Errorf("got %d events after the verify returned", n)
+	}
+}
@@ -1,27 +1,43 @@
 package vcs
 
 import (
-	"archive/zip"
 	"context"
 	"crypto/sha1"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
-	"path"
 	"path/filepath"
-	"strings"
+	"slices"
+	"sort"
+	"time"
 
+	"github.com/timo972/altv-cli/pkg/cache"
 	"github.com/timo972/altv-cli/pkg/cdn"
 	"github.com/timo972/altv-cli/pkg/cdn/altcdn"
+	"github.com/timo972/altv-cli/pkg/extract"
 	"github.com/timo972/altv-cli/pkg/logging"
 	"github.com/timo972/altv-cli/pkg/platform"
+	"github.com/timo972/altv-cli/pkg/ratelimit"
+	"github.com/timo972/altv-cli/pkg/retry"
 	"github.com/timo972/altv-cli/pkg/version"
 )
 
+type DownloadOptions struct {
+	// Manifests downloads the manifests of all modules, useful to verify the files later on.
+	Manifests bool
+	// Frozen refuses to install if a remote manifest differs from the one in the lockfile.
+	Frozen bool
+}
+
 type Downloader interface {
-	Download(ctx context.Context, path string, manifests bool) error
+	// Download installs all files of the modules and returns the outcome of every file, also on error.
+	Download(ctx context.Context, path string, opts DownloadOptions) (UpdateResult, error)
+	DownloadFiles(ctx context.Context, path string, files []*cdn.File) error
 }
 
 type downloader struct {
@@ -30,170 +46,686 @@ type downloader struct {
 	arch    platform.Arch
 	branch  version.Branch
 	modules []string
+	opts    options
+	// limit is shared by all downloads, cdnLimits by the downloads from the same cdn
+	limit     *ratelimit.Limiter
+	cdnLimits map[string]*ratelimit.Limiter
+	// slots limits the requests per host, every download holds one and every further segment of it another one
+	slots *hostSlots
 }
 
-func NewDownloader(arch platform.Arch, branch version.Branch, modules []string, registry CDNRegistry) Downloader {
+func NewDownloader(arch platform.Arch, branch version.Branch, modules []string, registry CDNRegistry, opts ...Option) Downloader {
+	o := newOptions(opts)
+	cdnLimits := make(map[string]*ratelimit.Limiter, len(o.cdnRateLimits))
+	for name, limit := range o.cdnRateLimits {
+		cdnLimits[name] = ratelimit.New(limit)
+	}
+
 	return &downloader{
-		CDNRegistry: registry,
+		CDNRegistry: o.registry(registry),
 		arch:        arch,
 		branch:      branch,
 		modules:     modules,
 		cdns:        []cdn.CDN{altcdn.Default},
+		opts:        o,
+		limit:       ratelimit.New(o.rateLimit),
+		cdnLimits:   cdnLimits,
+		slots:       newHostSlots(o.hostConcurrency),
 	}
 }
 
-// TODO: utilize goroutines to aggregate files simultaneously
-func (d *downloader) AggregateFiles(manifests bool) []*cdn.File {
-	allFiles := make([]*cdn.File, 0)
-	for _, module := range d.modules {
-		cdn, ok := d.moduleCDN(module)
-		if !ok {
-			logging.WarnLogger.Printf(newErrNoCDN(module).Error())
-			continue
+// httpClient returns the client the file is downloaded with, which is the one of its cdn unless WithHTTPClient is given.
+func (d *downloader) httpClient(file *cdn.File) *http.Client {
+	if d.opts.client != nil {
+		return d.opts.client
+	}
+	// files of unknown cdns get the shared client without credentials
+	name := ""
+	if c, ok := d.moduleCDN(file.Module); ok {
+		name = c.Name()
+	}
+	return d.cdnClient(name)
+}
+
+// limitReader throttles the response body of the file by the global limit and the limit of its cdn.
+func (d *downloader) limitReader(ctx context.Context, file *cdn.File, r io.Reader) io.Reader {
+	var cdnLimit *ratelimit.Limiter
+	if c, ok := d.moduleCDN(file.Module); ok {
+		cdnLimit = d.cdnLimits[c.Name()]
+	}
+	return ratelimit.NewReader(ctx, r, d.limit, cdnLimit)
+}
+
+// moduleFiles holds the manifest and files of a module resolved from its cdn.
+type moduleFiles struct {
+	module   string
+	cdn      cdn.CDN
+	manifest *cdn.Manifest
+	files    []*cdn.File
+}
+
+// resolveModules resolves the manifest and files of every module concurrently, bounded by the download concurrency.
+// Modules that can not be resolved are skipped and their errors joined, both in the order of the modules.
+func (d *downloader) resolveModules(ctx context.Context, manifests bool) ([]*moduleFiles, error) {
+	resolved := make([]*moduleFiles, len(d.modules))
+	errs := make([]error, len(d.modules))
+	forEach(ctx, len(d.modules), d.opts.concurrency, func(i int) {
+		resolved[i], errs[i] = d.resolveModule(ctx, d.modules[i], manifests)
+		if errs[i] != nil {
+			logging.WarnLogger.Printf(errs[i].Error())
 		}
-		logging.DebugLogger.Printf("cdn %v for module %s", cdn, module)
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
-		files, err := cdn.Files(d.branch, d.arch, module, manifests)
-		if err != nil {
-			logging.WarnLogger.Printf("no files for module %s found, skipping: %v", module, err)
-			continue
+	mods := make([]*moduleFiles, 0, len(resolved))
+	for _, mod := range resolved {
+		if mod != nil {
+			mods = append(mods, mod)
 		}
+	}
+	return mods, errors.Join(errs...)
+}
 
-		logging.DebugLogger.Printf("%d files for module %s", len(files), module)
-		allFiles = append(allFiles, files...)
+// resolveModule resolves the manifest and files of the module from its cdn.
+func (d *downloader) resolveModule(ctx context.Context, module string, manifests bool) (*moduleFiles, error) {
+	cdn, ok := d.moduleCDN(module)
+	if !ok {
+		return nil, newErrNoCDN(module)
 	}
+	logging.DebugLogger.Printf("cdn %v for module %s", cdn, module)
 
-	return allFiles
+	man, files, err := cdn.Files(ctx, d.branch, d.arch, module, manifests)
+	if err != nil {
+		return nil, newErrNoManifest(module, err)
+	}
+
+	logging.DebugLogger.Printf("%d files for module %s", len(files), module)
+	return &moduleFiles{
+		module:   module,
+		cdn:      cdn,
+		manifest: man,
+		files:    files,
+	}, nil
 }
 
 // DownloadFiles downloads all files from the given slice of files to the given path concurrently
 func (d *downloader) DownloadFiles(ctx context.Context, path string, files []*cdn.File) error {
-	// spin up a goroutine for each file download process
-	errs := make(chan error, len(files))
+	return d.downloadFiles(ctx, path, files, nil)
+}
+
+// downloadFiles downloads the files with a bounded number of workers and calls done with the outcome of every file.
+// The largest files are handed out first to minimize the total time, no more work is handed out once the context is canceled or a download failed.
+// Downloads aborted because of that are not reported to done.
+func (d *downloader) downloadFiles(ctx context.Context, path string, files []*cdn.File, done func(*cdn.File, error)) error {
+	if d.opts.offline {
+		if err := d.checkAvailable(ctx, files); err != nil {
+			return err
+		}
+	}
+
+	pending := slices.Clone(files)
+	sort.SliceStable(pending, func(i, j int) bool {
+		return pending[i].Size > pending[j].Size
+	})
+
+	left := make(map[string]int)
 	for _, file := range files {
-		go downloadFile(errs, path, file)
+		d.opts.observer.Observe(fileEvent(EventFileQueued, file))
+		left[file.Module]++
 	}
 
-	for range files {
-		select {
-		case err := <-errs:
-			logging.DebugLogger.Printf("got resp: %v", err)
-			if err != nil {
-				return err
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		file *cdn.File
+		err  error
+	}
+	results := make(chan result)
+	active := 0
+	var firstErr error
+
+	for {
+		for firstErr == nil && ctx.Err() == nil && (d.opts.concurrency <= 0 || active < d.opts.concurrency) {
+			// the first file whose host has a free slot takes it
+			i := slices.IndexFunc(pending, func(file *cdn.File) bool {
+				return d.slots.acquire(fileHost(file), 1) == 1
+			})
+			if i < 0 {
+				break
 			}
-		case <-ctx.Done():
-			return ctx.Err()
+
+			file := pending[i]
+			pending = slices.Delete(pending, i, i+1)
+			active++
+
+			logging.DebugLogger.Printf("downloading %s (%d active)", file.Name, active)
+			go func(file *cdn.File) {
+				results <- result{file: file, err: d.downloadFile(ctx, path, file)}
+			}(file)
+		}
+
+		if active == 0 {
+			break
+		}
+
+		r := <-results
+		active--
+		d.slots.release(fileHost(r.file), 1)
+		logging.DebugLogger.Printf("got resp: %v", r.err)
+
+		if r.err != nil && ctx.Err() != nil {
+			// aborted by cancellation or an earlier error
+			continue
 		}
+		if done != nil {
+			done(r.file, r.err)
+		}
+		if r.err != nil {
+			e := fileEvent(EventFileFailed, r.file)
+			e.Err = r.err
+			d.opts.observer.Observe(e)
+			firstErr = r.err
+			cancel()
+		} else if left[r.file.Module]--; left[r.file.Module] == 0 {
+			d.opts.observer.Observe(Event{Type: EventModuleDone, Module: r.file.Module})
+		}
+	}
+
+	if firstErr != nil {
+		return firstErr
 	}
+	return ctx.Err()
+}
 
+// checkAvailable returns an errMissing listing every file that is neither cached nor served by the http client, e.g. from a local mirror.
+func (d *downloader) checkAvailable(ctx context.Context, files []*cdn.File) error {
+	missing := make([]*cdn.File, 0)
+	for _, file := range files {
+		if d.opts.cache != nil && file.Hash != "" && d.opts.cache.Has(file.Hash) {
+			continue
+		}
+		if file.Url != "" && d.served(ctx, file) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		missing = append(missing, file)
+	}
+
+	if len(missing) > 0 {
+		return &errMissing{files: missing}
+	}
 	return nil
 }
 
-// Download aggregates all files from the given modules and downloads them to the given path
-func (d *downloader) Download(ctx context.Context, path string, manifests bool) error {
-	files := d.AggregateFiles(manifests)
-	logging.InfoLogger.Printf("downloading %d files", len(files))
-	return d.DownloadFiles(ctx, path, files)
+// served reports whether the http client serves the file.
+func (d *downloader) served(ctx context.Context, file *cdn.File) bool {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, file.Url, nil)
+	if err != nil {
+		return false
+	}
+
+	resp, err := d.httpClient(file).Do(req)
+	if err != nil {
+		logging.DebugLogger.Printf("%s not available: %v", file.Name, err)
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
 }
 
-// downloadFile is a utility to download the given file to the given path and verify its checksum
-func downloadFile(c chan error, p string, file *cdn.File) {
-	resp, err := http.DefaultClient.Get(file.Url)
+// fileHost returns the host the file is downloaded from.
+func fileHost(file *cdn.File) string {
+	u, err := url.Parse(file.Url)
 	if err != nil {
-		c <- err
-		return
+		return ""
 	}
-	defer resp.Body.Close()
-	logging.DebugLogger.Printf("got response: %s", resp.Status)
+	return u.Host
+}
 
-	if resp.StatusCode != http.StatusOK {
-		c <- fmt.Errorf("unexpected statusCode at download of%s: %s", file.Name, resp.Status)
-		return
+// Download aggregates all files from the given modules and downloads them to the given path.
+// Files are staged next to the installation and only moved into place once every download succeeded.
+// An interrupted download of the same files is resumed.
+func (d *downloader) Download(ctx context.Context, path string, opts DownloadOptions) (UpdateResult, error) {
+	pending, err := recoverJournal(path)
+	if err != nil {
+		return nil, err
 	}
 
-	logging.DebugLogger.Printf("opening file %s", file.Name)
+	mods, resolveErr := d.resolveModules(ctx, opts.Manifests)
+	if len(mods) == 0 && resolveErr != nil {
+		return nil, resolveErr
+	}
 
-	fol := fmt.Sprintf("%s/%s", p, path.Dir(file.Name))
-	logging.DebugLogger.Printf("file folder: %s", p)
+	var lock *Lockfile
+	if opts.Frozen {
+		if lock, err = ReadLockfile(path); err != nil {
+			return nil, fmt.Errorf("frozen install requires a lockfile: %w", err)
+		}
+	} else if lock, err = readOrNewLockfile(path); err != nil {
+		return nil, err
+	}
 
-	if _, err := os.Stat(fol); os.IsNotExist(err) {
-		if err = os.MkdirAll(fol, 0700); err != nil {
-			c <- fmt.Errorf("can not create directory %s: %w", file.Name, err)
-			return
+	result := make(UpdateResult, 0, len(mods))
+	files := make([]*cdn.File, 0)
+	for _, mod := range mods {
+		if opts.Frozen {
+			if err = lock.verify(mod.module, d.branch, d.arch, mod.manifest); err != nil {
+				return nil, fmt.Errorf("remote manifest differs from %s: %w", LockfileName, err)
+			}
 		}
+		lock.lock(mod.module, d.branch, d.arch, mod.cdn, mod.manifest)
+		result = append(result, installedModule(path, mod))
+		files = append(files, mod.files...)
 	}
 
-	f, err := os.OpenFile(fmt.Sprintf("%s/%s", p, file.Name), os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	tx, remaining, err := beginTransaction(path, "install", files, pending)
 	if err != nil {
-		c <- fmt.Errorf("can not open file %s: %w", file.Name, err)
-		return
+		return result, err
 	}
-	defer f.Close()
 
-	logging.DebugLogger.Printf("writing file %s", file.Name)
+	logging.InfoLogger.Printf("downloading %d files", len(remaining))
+	tracker := result.newTracker(remaining, tx.journal.done)
+	err = d.downloadFiles(ctx, tx.dir, remaining, tracker.finish)
+	tracker.close()
+	if err != nil {
+		tx.abort(err)
+		return result, err
+	}
+
+	if err = lock.Write(tx.dir); err != nil {
+		tx.abort(err)
+		return result, fmt.Errorf("unable to write %s: %w", LockfileName, err)
+	}
+
+	if err = tx.commit(); err != nil {
+		return result, err
+	}
+
+	if resolveErr != nil {
+		return result, newErrPartial(resolveErr)
+	}
+	return result, nil
+}
+
+// installedModule describes the install of all files of the module.
+func installedModule(path string, mod *moduleFiles) *ModuleUpdate {
+	upd := &ModuleUpdate{
+		Module:    mod.module,
+		ToVersion: mod.manifest.Version,
+		Files:     make([]*FileChange, len(mod.files)),
+	}
+	if lman, err := readLocalManifest(path, mod.module); err == nil {
+		upd.FromVersion = lman.Version
+	}
+
+	for i, file := range mod.files {
+		upd.Files[i] = &FileChange{Name: file.Name, Change: FileAdded, Size: file.Size}
+	}
+
+	return upd
+}
+
+// partSuffix is appended to files while they are downloaded, partial downloads are resumed from it.
+const partSuffix = ".part"
+
+// downloadFile is a utility to download the given file to the given path and verify its checksum.
+// The file is written to a .part file first, an existing .part file from an interrupted download is resumed if the server supports range requests.
+// Interrupted downloads are retried according to the retry policy.
+func (d *downloader) downloadFile(ctx context.Context, p string, file *cdn.File) error {
+	if ok, err := d.restoreCached(p, file); ok || err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := d.fetchPart(ctx, p, file)
+		var interrupted *errInterrupted
+		if attempt > d.opts.retry.Retries || ctx.Err() != nil || !errors.As(err, &interrupted) {
+			return err
+		}
+
+		delay := d.opts.retry.Backoff(attempt)
+		logging.DebugLogger.Printf("resuming %s in %s (%d/%d): %v", file.Name, delay.Round(time.Millisecond), attempt, d.opts.retry.Retries, err)
+		if err = retry.Sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// fetchPart downloads the file into its .part file, verifies it and moves it into place. Large files are downloaded in concurrent segments.
+func (d *downloader) fetchPart(ctx context.Context, p string, file *cdn.File) error {
+	dst, err := resolvePath(p, file.Name)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+		return fmt.Errorf("can not create directory %s: %w", file.Name, err)
+	}
+
+	part := dst + partSuffix
+	f, err := os.OpenFile(part, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("can not open file %s: %w", file.Name, err)
+	}
+	defer f.Close()
 
+	// re-hash the existing prefix, so the checksum covers the whole file
 	h := sha1.New()
-	bodyReader := io.TeeReader(resp.Body, h)
+	offset, err := io.Copy(h, f)
+	if err != nil {
+		return fmt.Errorf("can not read partial download of %s: %w", file.Name, err)
+	}
+
+	prog := newFileProgress(d.opts.observer, file)
+	prog.set(offset)
+
+	if file.Size >= 0 && offset > int64(file.Size) {
+		logging.DebugLogger.Printf("partial download of %s exceeds its size, restarting", file.Name)
+		if offset, err = restartPart(f, h, prog); err != nil {
+			return err
+		}
+	}
+
+	if n := d.segments(file, offset); n > 1 {
+		err = d.fetchSegments(ctx, f, file, prog, n)
+		d.slots.release(fileHost(file), n-1)
+		if errors.Is(err, errNoRanges) {
+			logging.DebugLogger.Printf("%s for %s, downloading in a single stream", err, file.Name)
+			// other segments may have been written already
+			if offset, err = restartPart(f, h, prog); err == nil {
+				err = d.fetchFile(ctx, f, h, prog, file, offset)
+			}
+		} else if err == nil {
+			// the segments arrived out of order, hash the reassembled file
+			if _, err = f.Seek(0, io.SeekStart); err == nil {
+				_, err = io.Copy(h, f)
+			}
+		}
+	} else if file.Size < 0 || offset < int64(file.Size) {
+		err = d.fetchFile(ctx, f, h, prog, file, offset)
+	}
+	if err != nil {
+		return err
+	}
+	logging.DebugLogger.Printf("wrote file %s, checking size and checksum", file.Name)
 
-	if _, err = io.Copy(f, bodyReader); err != nil {
-		c <- fmt.Errorf("can not write file %s: %w", file.Name, err)
-		return
+	if size, err := f.Seek(0, io.SeekEnd); err != nil {
+		return fmt.Errorf("can not read file %s: %w", file.Name, err)
+	} else if file.Size >= 0 && size != int64(file.Size) {
+		f.Close()
+		os.Remove(part)
+		return fmt.Errorf("size mismatch for %s: expected %d bytes, got %d; be careful! file might be corrupted", file.Name, file.Size, size)
 	}
-	logging.DebugLogger.Printf("wrote file %s, checking checksum", file.Name)
 
 	if file.Hash == "" {
 		if file.Type != cdn.ModuleManifestFile {
 			logging.WarnLogger.Printf("no checksum for %s, be careful!", file.Name)
 		}
-		c <- nil
-		return
+	} else if checksum := hex.EncodeToString(h.Sum(nil)); checksum != file.Hash {
+		f.Close()
+		os.Remove(part)
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s; be careful! file might be corrupted", file.Name, file.Hash, checksum)
+	} else {
+		logging.DebugLogger.Printf("checksum for %s is ok", file.Name)
 	}
+	d.opts.observer.Observe(fileEvent(EventFileVerified, file))
 
-	checksum := hex.EncodeToString(h.Sum(nil))
-	if checksum != file.Hash {
-		c <- fmt.Errorf("checksum mismatch for %s: expected %s, got %s; be careful! file might be corrupted", file.Name, file.Hash, checksum)
-		return
+	// flush the file to disk before it replaces the previous version, so a crash can not leave a truncated file in place
+	if err = f.Sync(); err != nil {
+		return fmt.Errorf("can not write file %s: %w", file.Name, err)
+	}
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("can not write file %s: %w", file.Name, err)
 	}
 
-	logging.DebugLogger.Printf("checksum for %s is ok", file.Name)
+	if d.opts.cache != nil && file.Hash != "" {
+		if err = cachePart(d.opts.cache, file, part); err != nil {
+			logging.WarnLogger.Printf("unable to cache %s: %v", file.Name, err)
+		}
+	}
 
-	stat, err := f.Stat()
+	return d.install(p, part, dst, file)
+}
+
+func cachePart(c cache.Cache, file *cdn.File, part string) error {
+	f, err := os.Open(part)
 	if err != nil {
-		logging.DebugLogger.Printf("file size read errpr for %s", f.Name())
-		c <- err
-		return
+		return err
 	}
+	defer f.Close()
+	return c.Put(file.Hash, f)
+}
 
-	if !strings.HasSuffix(f.Name(), ".zip") {
-		c <- nil
-		return
+// restoreCached copies the file from the cache into place and reports whether it was cached.
+// Cache errors are not fatal, the file is downloaded instead.
+func (d *downloader) restoreCached(p string, file *cdn.File) (bool, error) {
+	if d.opts.cache == nil || file.Hash == "" {
+		return false, nil
 	}
 
-	archive, err := zip.NewReader(f, stat.Size())
+	dst, err := resolvePath(p, file.Name)
 	if err != nil {
-		c <- fmt.Errorf("failed to unzip file %s: %w", f.Name(), err)
-		return
+		return false, err
 	}
 
-	for _, f := range archive.File {
-		filePath := filepath.Join(fol, f.Name)
-		dstFile, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
-		if err != nil {
-			logging.WarnLogger.Printf("could not unzip %s", filePath)
-			continue
+	if err = os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+		return false, fmt.Errorf("can not create directory %s: %w", file.Name, err)
+	}
+
+	part := dst + partSuffix
+	ok, err := d.opts.cache.Get(file.Hash, part)
+	if err != nil {
+		logging.DebugLogger.Printf("unable to restore %s from cache: %v", file.Name, err)
+		os.Remove(part)
+		return false, nil
+	} else if !ok {
+		return false, nil
+	}
+
+	logging.DebugLogger.Printf("restored %s from cache", file.Name)
+	newFileProgress(d.opts.observer, file).set(int64(file.Size))
+	d.opts.observer.Observe(fileEvent(EventFileVerified, file))
+	return true, d.install(p, part, dst, file)
+}
+
+// install moves the verified part file into place and extracts it, if it is an archive.
+// The extracted files are recorded in the installation at p, so they can be verified and removed with the archive.
+func (d *downloader) install(p, part, dst string, file *cdn.File) error {
+	if err := os.Rename(part, dst); err != nil {
+		return fmt.Errorf("can not move %s into place: %w", file.Name, err)
+	}
+	syncDir(filepath.Dir(dst))
+
+	if !extract.Supported(dst) {
+		return nil
+	}
+
+	entries, err := extract.Extract(dst, filepath.Dir(dst))
+	if err != nil {
+		return err
+	}
+	if err = writeExtraction(p, newExtraction(file.Name, entries)); err != nil {
+		return fmt.Errorf("unable to record files extracted from %s: %w", file.Name, err)
+	}
+	logging.DebugLogger.Printf("extracted %d files from %s", len(entries), file.Name)
+	d.opts.observer.Observe(fileEvent(EventFileExtracted, file))
+	return nil
+}
+
+// fetchFile downloads the file from the given offset on and appends it to f, h and prog.
+// If the server ignores the range request, the file is downloaded from the start.
+func (d *downloader) fetchFile(ctx context.Context, f *os.File, h hash.Hash, prog *fileProgress, file *cdn.File, offset int64) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, file.Url, nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := d.httpClient(file).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	logging.DebugLogger.Printf("got response: %s", resp.Status)
+
+	switch {
+	case offset > 0 && resp.StatusCode == http.StatusPartialContent && contentRangeStart(resp) == offset:
+		logging.DebugLogger.Printf("resuming %s at %d bytes", file.Name, offset)
+	case offset > 0 && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		logging.DebugLogger.Printf("can not resume %s, restarting", file.Name)
+		if _, err = restartPart(f, h, prog); err != nil {
+			return err
+		}
+		return d.fetchFile(ctx, f, h, prog, file, 0)
+	case resp.StatusCode == http.StatusOK:
+		if offset > 0 {
+			logging.DebugLogger.Printf("server does not support range requests for %s, restarting", file.Name)
+			if _, err = restartPart(f, h, prog); err != nil {
+				return err
+			}
 		}
-		defer dstFile.Close()
+	default:
+		return fmt.Errorf("unexpected statusCode at download of %s: %s", file.Name, resp.Status)
+	}
 
-		fileReader, err := f.Open()
-		if err != nil {
-			logging.WarnLogger.Printf("could not open fileReader: %v", err)
-			continue
+	logging.DebugLogger.Printf("writing file %s", file.Name)
+	if _, err = io.Copy(io.MultiWriter(f, h, prog), d.limitReader(ctx, file, interruptible{resp.Body})); err != nil {
+		return fmt.Errorf("can not write file %s: %w", file.Name, err)
+	}
+	return nil
+}
+
+// segments returns the number of segments the file is downloaded in, 1 for a single stream.
+// The download holds a slot of its host already, every further segment takes another free one, which the caller releases.
+func (d *downloader) segments(file *cdn.File, offset int64) int {
+	if offset > 0 || d.opts.segments < 2 || file.Size <= 0 || file.Size < d.opts.segmentThreshold {
+		return 1
+	}
+	// at least one byte per segment
+	n := min(d.opts.segments, file.Size)
+	return 1 + d.slots.acquire(fileHost(file), n-1)
+}
+
+// errNoRanges is returned by fetchSegments if the server does not support range requests for the file.
+var errNoRanges = errors.New("server does not support range requests")
+
+// fetchSegments downloads the file in n concurrent byte ranges into f.
+// On error f is truncated to the downloaded prefix, so the download can be resumed.
+func (d *downloader) fetchSegments(ctx context.Context, f *os.File, file *cdn.File, prog *fileProgress, n int) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, file.Url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := d.httpClient(file).Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	size := int64(file.Size)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Accept-Ranges") != "bytes" || resp.ContentLength != size {
+		return errNoRanges
+	}
+
+	if err = f.Truncate(size); err != nil {
+		return fmt.Errorf("can not allocate %s: %w", file.Name, err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	segment := (size + int64(n) - 1) / int64(n)
+	written := make([]int64, n)
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		start := int64(i) * segment
+		end := min(start+segment, size) - 1
+		go func(i int, start, end int64) {
+			errs <- d.fetchSegment(ctx, f, prog, file, start, end, &written[i])
+		}(i, start, end)
+	}
+
+	var firstErr error
+	for i := 0; i < n; i++ {
+		if err := <-errs; err != nil && firstErr == nil {
+			firstErr = err
+			cancel()
 		}
-		defer fileReader.Close()
+	}
+	if firstErr == nil {
+		logging.DebugLogger.Printf("downloaded %s in %d segments", file.Name, n)
+		return nil
+	}
 
-		if _, err := io.Copy(dstFile, fileReader); err != nil {
-			logging.WarnLogger.Printf("could not copy zip content: %v", err)
-			continue
+	prefix := int64(0)
+	for i := 0; i < n; i++ {
+		prefix += written[i]
+		if written[i] < min(segment, size-int64(i)*segment) {
+			break
 		}
 	}
+	if err := f.Truncate(prefix); err != nil {
+		logging.WarnLogger.Printf("unable to keep partial download of %s: %v", file.Name, err)
+	}
+	prog.set(prefix)
+	return firstErr
+}
+
+// fetchSegment downloads the bytes start to end (inclusive) of the file into the same range of f.
+func (d *downloader) fetchSegment(ctx context.Context, f *os.File, prog *fileProgress, file *cdn.File, start, end int64, written *int64) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, file.Url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+
+	resp, err := d.httpClient(file).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// some servers advertise range support but answer ranged requests with the whole file
+	if resp.StatusCode == http.StatusOK {
+		return errNoRanges
+	}
+	if resp.StatusCode != http.StatusPartialContent || contentRangeStart(resp) != start {
+		return fmt.Errorf("unexpected response for bytes %d-%d of %s: %s", start, end, file.Name, resp.Status)
+	}
+
+	*written, err = io.Copy(io.MultiWriter(io.NewOffsetWriter(f, start), prog), io.LimitReader(d.limitReader(ctx, file, interruptible{resp.Body}), end-start+1))
+	if err != nil {
+		return fmt.Errorf("can not write file %s: %w", file.Name, err)
+	}
+	if *written != end-start+1 {
+		return fmt.Errorf("can not write file %s: %w", file.Name, &errInterrupted{e: io.ErrUnexpectedEOF})
+	}
+	return nil
+}
+
+// restartPart empties the partial download and resets its hash and progress.
+func restartPart(f *os.File, h hash.Hash, prog *fileProgress) (int64, error) {
+	h.Reset()
+	prog.set(0)
+	if err := f.Truncate(0); err != nil {
+		return 0, fmt.Errorf("can not truncate %s: %w", f.Name(), err)
+	}
+	return f.Seek(0, io.SeekStart)
+}
+
+// contentRangeStart returns the first byte position of a partial response, -1 if unknown.
+func contentRangeStart(resp *http.Response) int64 {
+	var start, end int64
+	if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d", &start, &end); err != nil {
+		return -1
+	}
+	return start
 }
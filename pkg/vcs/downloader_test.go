@@ -0,0 +1,319 @@
+package vcs
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/timo972/altv-cli/pkg/cdn"
+	"github.com/timo972/altv-cli/pkg/platform"
+	"github.com/timo972/altv-cli/pkg/version"
+)
+
+// fileServer serves content by path and records the number of concurrent requests, in total and per host.
+type fileServer struct {
+	*httptest.Server
+	files map[string]string
+	delay time.Duration
+	// noRanges ignores range requests and always serves the whole file.
+	noRanges bool
+
+	mu        sync.Mutex
+	active    map[string]int
+	maxActive int
+	maxHost   int
+	requests  []*http.Request
+}
+
+func newFileServer(t *testing.T, files map[string]string, delay time.Duration) *fileServer {
+	s := &fileServer{files: files, delay: delay, active: make(map[string]int)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *fileServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r)
+	s.active[r.Host]++
+	total := 0
+	for _, n := range s.active {
+		total += n
+	}
+	s.maxActive = max(s.maxActive, total)
+	s.maxHost = max(s.maxHost, s.active[r.Host])
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.active[r.Host]--
+		s.mu.Unlock()
+	}()
+
+	content, ok := s.files[strings.TrimPrefix(r.URL.Path, "/")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	time.Sleep(s.delay)
+	if s.noRanges {
+		w.Write([]byte(content))
+		return
+	}
+	http.ServeContent(w, r, r.URL.Path, time.Time{}, strings.NewReader(content))
+}
+
+// file returns the cdn file served under name.
+func (s *fileServer) file(name string) *cdn.File {
+	return s.fileAt(s.URL, name)
+}
+
+// fileAt returns the cdn file served under name, reached at the base url.
+func (s *fileServer) fileAt(base, name string) *cdn.File {
+	return &cdn.File{
+		Type: cdn.ModuleFile,
+		Name: name,
+		Url:  base + "/" + name,
+		Hash: sha1Hex(s.files[name]),
+		Size: len(s.files[name]),
+	}
+}
+
+func newTestDownloader(opts ...Option) *downloader {
+	return NewDownloader(platform.Arch("x64_linux"), version.Branch("release"), nil, NewRegistry(), opts...).(*downloader)
+}
+
+func TestDownloadFilesLimits(t *testing.T) {
+	// every host serves its own files, the second host is the same server reached by another name
+	files := make(map[string]string)
+	for i := 0; i < 6; i++ {
+		files[fmt.Sprintf("a/file%d.so", i)] = strings.Repeat("a", 100*(i+1))
+		files[fmt.Sprintf("b/file%d.so", i)] = strings.Repeat("b", 100*(i+1))
+	}
+
+	tests := []struct {
+		name     string
+		total    int
+		perHost  int
+		segments int
+		maxTotal int
+		maxHost  int
+	}{
+		{"per host limit", 4, 1, 1, 2, 1},
+		{"total limit", 3, 4, 1, 3, 3},
+		{"sequential", 1, 0, 1, 1, 1},
+		{"segments take slots of the host", 8, 2, 4, 4, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newFileServer(t, files, 20*time.Millisecond)
+			other := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+
+			list := make([]*cdn.File, 0, len(files))
+			for name := range files {
+				if strings.HasPrefix(name, "a/") {
+					list = append(list, srv.file(name))
+				} else {
+					list = append(list, srv.fileAt(other, name))
+				}
+			}
+
+			var mu sync.Mutex
+			done := 0
+			dir := t.TempDir()
+			d := newTestDownloader(WithConcurrency(tt.total, tt.perHost), WithSegments(tt.segments, 1))
+			err := d.downloadFiles(context.Background(), dir, list, func(file *cdn.File, err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					t.Errorf("%s: %v", file.Name, err)
+				}
+				done++
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if done != len(list) {
+				t.Errorf("%d files reported done, want %d", done, len(list))
+			}
+
+			if srv.maxActive > tt.maxTotal {
+				t.Errorf("%d concurrent downloads, want at most %d", srv.maxActive, tt.maxTotal)
+			}
+			if srv.maxHost > tt.maxHost {
+				t.Errorf("%d concurrent downloads from one host, want at most %d", srv.maxHost, tt.maxHost)
+			}
+			for name, content := range files {
+				data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+				if err != nil || string(data) != content {
+					t.Errorf("%s not downloaded: %v", name, err)
+				}
+			}
+		})
+	}
+}
+
+func TestDownloadFilesLargestFirst(t *testing.T) {
+	files := map[string]string{"small": "s", "large": strings.Repeat("l", 1000), "medium": strings.Repeat("m", 100)}
+	srv := newFileServer(t, files, 0)
+
+	list := []*cdn.File{srv.file("small"), srv.file("large"), srv.file("medium")}
+	if err := newTestDownloader(WithConcurrency(1, 0)).downloadFiles(context.Background(), t.TempDir(), list, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	order := make([]string, 0, len(srv.requests))
+	for _, r := range srv.requests {
+		if r.Method == http.MethodGet {
+			order = append(order, strings.TrimPrefix(r.URL.Path, "/"))
+		}
+	}
+	if strings.Join(order, ",") != "large,medium,small" {
+		t.Errorf("downloaded in order %v, want the largest first", order)
+	}
+}
+
+func TestDownloadFileResume(t *testing.T) {
+	content := strings.Repeat("0123456789", 100)
+
+	tests := []struct {
+		name     string
+		part     string
+		noRanges bool
+		// rng is the expected Range header of the first request.
+		rng     string
+		wantErr bool
+	}{
+		{"resumes the partial download", content[:400], false, "bytes=400-", false},
+		{"restarts if the server ignores ranges", content[:400], true, "bytes=400-", false},
+		{"restarts a partial download exceeding the size", content + "junk", false, "", false},
+		{"discards a corrupted partial download", "corrupted", false, "bytes=9-", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newFileServer(t, map[string]string{"altv-server": content}, 0)
+			srv.noRanges = tt.noRanges
+
+			dir := t.TempDir()
+			dst := filepath.Join(dir, "altv-server")
+			if err := os.WriteFile(dst+partSuffix, []byte(tt.part), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			err := newTestDownloader().downloadFile(context.Background(), dir, srv.file("altv-server"))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if len(srv.requests) == 0 {
+				t.Fatal("file not requested")
+			}
+			if got := srv.requests[0].Header.Get("Range"); got != tt.rng {
+				t.Errorf("requested range %q, want %q", got, tt.rng)
+			}
+			if _, err := os.Stat(dst + partSuffix); !os.IsNotExist(err) {
+				t.Errorf("partial download left behind: %v", err)
+			}
+
+			data, err := os.ReadFile(dst)
+			if tt.wantErr {
+				if !os.IsNotExist(err) {
+					t.Errorf("corrupted file moved into place: %v", err)
+				}
+				return
+			}
+			if err != nil || string(data) != content {
+				t.Errorf("got %d bytes, want %d: %v", len(data), len(content), err)
+			}
+		})
+	}
+}
+
+func TestDownloadFileVerifies(t *testing.T) {
+	content := strings.Repeat("0123456789", 100)
+
+	tests := []struct {
+		name    string
+		size    int
+		hash    string
+		wantErr bool
+	}{
+		{"valid", len(content), sha1Hex(content), false},
+		{"truncated", len(content) + 1, sha1Hex(content), true},
+		{"oversized", len(content) - 1, sha1Hex(content), true},
+		{"checksum mismatch", len(content), sha1Hex("other"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newFileServer(t, map[string]string{"altv-server": content}, 0)
+			file := srv.file("altv-server")
+			file.Size, file.Hash = tt.size, tt.hash
+
+			// the previous version stays in place unless the download is verified
+			dir := t.TempDir()
+			writeTree(t, dir, map[string]string{"altv-server": "previous"})
+
+			err := newTestDownloader().downloadFile(context.Background(), dir, file)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			want := content
+			if tt.wantErr {
+				want = "previous"
+			}
+			if got := readTree(t, dir); len(got) != 1 || got["altv-server"] != want {
+				t.Errorf("got %d files, altv-server with %d bytes, want %d bytes", len(got), len(got["altv-server"]), len(want))
+			}
+		})
+	}
+}
+
+func TestDownloadFileSegments(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		segments int
+		// ranges is the number of ranged requests.
+		ranges int
+	}{
+		{"segmented", strings.Repeat("0123456789", 100), 4, 4},
+		{"at most one segment per byte", "abc", 8, 3},
+		{"empty file", "", 4, 0},
+		{"disabled", strings.Repeat("0123456789", 100), 1, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newFileServer(t, map[string]string{"altv-server": tt.content}, 0)
+			dir := t.TempDir()
+
+			d := newTestDownloader(WithSegments(tt.segments, 0))
+			if err := d.downloadFile(context.Background(), dir, srv.file("altv-server")); err != nil {
+				t.Fatal(err)
+			}
+
+			ranges := 0
+			for _, r := range srv.requests {
+				if r.Method == http.MethodGet && r.Header.Get("Range") != "" {
+					ranges++
+				}
+			}
+			if ranges != tt.ranges {
+				t.Errorf("got %d ranged requests, want %d", ranges, tt.ranges)
+			}
+			if got := readTree(t, dir); got["altv-server"] != tt.content {
+				t.Errorf("got %q, want %q", got["altv-server"], tt.content)
+			}
+		})
+	}
+}
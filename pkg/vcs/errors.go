@@ -1,7 +1,12 @@
 package vcs
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"strings"
+
+	"github.com/timo972/altv-cli/pkg/cdn"
 )
 
 type errNoCDN struct {
@@ -25,6 +30,91 @@ func (e *errNoManifest) Error() string {
 	return fmt.Sprintf("no manifest for module %s found: %v", e.mod, e.e)
 }
 
+func (e *errNoManifest) Unwrap() error {
+	return e.e
+}
+
 func newErrNoManifest(mod string, e error) error {
 	return &errNoManifest{mod: mod, e: e}
 }
+
+// errPartial is returned if an operation succeeded for some modules but failed for others.
+type errPartial struct {
+	e error
+}
+
+func (e *errPartial) Error() string {
+	return fmt.Sprintf("partially failed: %v", e.e)
+}
+
+func (e *errPartial) Unwrap() error {
+	return e.e
+}
+
+func newErrPartial(e error) error {
+	return &errPartial{e: e}
+}
+
+// joinPartial joins the errors of the failed modules into a partial error, nil if no module failed.
+func joinPartial(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return newErrPartial(errors.Join(errs...))
+}
+
+// IsPartial reports whether the operation succeeded for some modules but failed for others.
+func IsPartial(err error) bool {
+	var e *errPartial
+	return errors.As(err, &e)
+}
+
+// IsUnreachable reports whether the manifest of a module could not be fetched from its cdn, or files are missing offline.
+func IsUnreachable(err error) bool {
+	var e *errNoManifest
+	var m *errMissing
+	return errors.As(err, &e) || errors.As(err, &m)
+}
+
+// errMissing is returned by offline downloads if files are neither cached nor mirrored.
+type errMissing struct {
+	files []*cdn.File
+}
+
+func (e *errMissing) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d files are not available offline:", len(e.files))
+	for _, file := range e.files {
+		fmt.Fprintf(&b, "\n  %s: %s", file.Module, file.Name)
+		if file.Hash != "" {
+			fmt.Fprintf(&b, " (sha1 %s)", file.Hash)
+		}
+	}
+	return b.String()
+}
+
+// errInterrupted is returned if a download was interrupted while reading the response, e.g. by a dropped connection.
+type errInterrupted struct {
+	e error
+}
+
+func (e *errInterrupted) Error() string {
+	return fmt.Sprintf("download interrupted: %v", e.e)
+}
+
+func (e *errInterrupted) Unwrap() error {
+	return e.e
+}
+
+// interruptible tags read errors of the response body as errInterrupted.
+type interruptible struct {
+	io.Reader
+}
+
+func (r interruptible) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		err = &errInterrupted{e: err}
+	}
+	return n, err
+}
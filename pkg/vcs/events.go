@@ -0,0 +1,108 @@
+package vcs
+
+import (
+	"sync/atomic"
+
+	"github.com/timo972/altv-cli/pkg/cdn"
+)
+
+type EventType uint8
+
+const (
+	// EventFileQueued is emitted for every file before it is downloaded or verified, Size holds its size.
+	EventFileQueued EventType = iota
+	// EventFileProgress is emitted while a file is downloaded, Bytes holds the bytes of the file downloaded so far.
+	EventFileProgress
+	// EventFileVerified is emitted once the checksum of a downloaded or installed file has been verified.
+	EventFileVerified
+	// EventFileFailed is emitted if a file could not be downloaded or failed verification, Err holds the reason.
+	EventFileFailed
+	// EventFileExtracted is emitted once a downloaded archive has been extracted.
+	EventFileExtracted
+	// EventModuleDone is emitted once every file of a module has been downloaded or verified.
+	EventModuleDone
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventFileQueued:
+		return "queued"
+	case EventFileProgress:
+		return "progress"
+	case EventFileVerified:
+		return "verified"
+	case EventFileFailed:
+		return "failed"
+	case EventFileExtracted:
+		return "extracted"
+	case EventModuleDone:
+		return "module done"
+	default:
+		return "unknown"
+	}
+}
+
+type Event struct {
+	Type   EventType
+	Module string
+	// File is empty for module events.
+	File  string
+	Bytes int64
+	// Size of the file in bytes, negative if unknown.
+	Size int64
+	Err  error
+}
+
+// Observer receives the progress events of a Downloader, Checker or Updater.
+// Observe is called concurrently from multiple goroutines and should return quickly.
+type Observer interface {
+	Observe(Event)
+}
+
+type ObserverFunc func(Event)
+
+func (f ObserverFunc) Observe(e Event) {
+	f(e)
+}
+
+type nopObserver struct{}
+
+func (nopObserver) Observe(Event) {}
+
+// fileEvent returns an event of the given type for the file.
+func fileEvent(t EventType, file *cdn.File) Event {
+	return Event{
+		Type:   t,
+		Module: file.Module,
+		File:   file.Name,
+		Size:   int64(file.Size),
+	}
+}
+
+// fileProgress reports the bytes of a file downloaded so far, it is written to like the file itself.
+type fileProgress struct {
+	obs  Observer
+	file *cdn.File
+	n    atomic.Int64
+}
+
+func newFileProgress(obs Observer, file *cdn.File) *fileProgress {
+	return &fileProgress{obs: obs, file: file}
+}
+
+func (p *fileProgress) emit(n int64) {
+	e := fileEvent(EventFileProgress, p.file)
+	e.Bytes = n
+	p.obs.Observe(e)
+}
+
+// set resets the progress, e.g. if a partial download has to be restarted.
+func (p *fileProgress) set(n int64) {
+	p.n.Store(n)
+	p.emit(n)
+}
+
+func (p *fileProgress) Write(b []byte) (int, error) {
+	p.emit(p.n.Add(int64(len(b))))
+	return len(b), nil
+}
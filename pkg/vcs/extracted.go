@@ -0,0 +1,100 @@
+package vcs
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/timo972/altv-cli/pkg/extract"
+)
+
+// extractedDir is the directory inside StateDir the files extracted from archives are recorded in.
+const extractedDir = "extracted"
+
+// extraction records the files extracted from an archive of a module, so they can be verified and removed with it.
+type extraction struct {
+	Archive string `json:"archive"`
+	// Files are relative to the installation.
+	Files []*extract.Entry `json:"files"`
+}
+
+// extractionRecord returns the slash separated path of the record of the archive, relative to the installation.
+func extractionRecord(archive string) string {
+	h := sha1.Sum([]byte(archive))
+	return path.Join(StateDir, extractedDir, hex.EncodeToString(h[:])+".json")
+}
+
+// newExtraction makes the entries extracted next to the archive relative to the installation.
+func newExtraction(archive string, entries []*extract.Entry) *extraction {
+	files := make([]*extract.Entry, len(entries))
+	for i, entry := range entries {
+		e := *entry
+		e.Name = path.Join(path.Dir(archive), entry.Name)
+		files[i] = &e
+	}
+	return &extraction{Archive: archive, Files: files}
+}
+
+// readExtraction reads the record of the archive, nil if the archive has not been extracted by the cli.
+func readExtraction(p, archive string) (*extraction, error) {
+	data, err := os.ReadFile(filepath.Join(p, filepath.FromSlash(extractionRecord(archive))))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var ex extraction
+	if err = json.Unmarshal(data, &ex); err != nil {
+		return nil, err
+	}
+	return &ex, nil
+}
+
+// writeExtraction records the extracted files in the installation.
+func writeExtraction(p string, ex *extraction) error {
+	name := filepath.Join(p, filepath.FromSlash(extractionRecord(ex.Archive)))
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(ex, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, data, 0644)
+}
+
+// readExtractions reads the records of all archives extracted in the installation.
+func readExtractions(p string) ([]*extraction, error) {
+	entries, err := os.ReadDir(filepath.Join(p, StateDir, extractedDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	exs := make([]*extraction, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(p, StateDir, extractedDir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var ex extraction
+		if err = json.Unmarshal(data, &ex); err != nil {
+			return nil, fmt.Errorf("invalid record %s: %w", entry.Name(), err)
+		}
+		exs = append(exs, &ex)
+	}
+	return exs, nil
+}
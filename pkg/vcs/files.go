@@ -0,0 +1,107 @@
+package vcs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// resolvePath joins the manifest file name onto the installation path and makes sure it does not escape it.
+func resolvePath(path, name string) (string, error) {
+	fpath := filepath.Join(path, filepath.FromSlash(name))
+	rel, err := filepath.Rel(path, fpath)
+	if err != nil {
+		return "", err
+	}
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("file %s is outside of %s", name, path)
+	}
+	return fpath, nil
+}
+
+// removeFile deletes the given file from the installation and cleans up the directories it leaves empty.
+func removeFile(path, name string) error {
+	fpath, err := resolvePath(path, name)
+	if err != nil {
+		return err
+	}
+
+	if err = os.Remove(fpath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	root := filepath.Clean(path)
+	for dir := filepath.Dir(fpath); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		// fails for non-empty directories, which ends the cleanup
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+
+	return nil
+}
+
+// copyFile copies the file at src to dst, creating the parent directories of dst.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	stat, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, stat.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err = io.Copy(out, in); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// copyDir copies all files below src into dst. A missing src is treated as empty.
+func copyDir(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && path == src {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		return copyFile(path, filepath.Join(dst, rel))
+	})
+}
+
+// syncDir flushes the directory entries, so a rename inside the directory survives a crash.
+// Not every platform supports syncing directories, errors are ignored.
+func syncDir(dir string) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	f.Sync()
+}
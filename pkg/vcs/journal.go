@@ -0,0 +1,322 @@
+package vcs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/timo972/altv-cli/pkg/cdn"
+	"github.com/timo972/altv-cli/pkg/logging"
+)
+
+const journalFile = "journal.json"
+
+type journalState string
+
+const (
+	journalDownloading journalState = "downloading"
+	journalCommitting  journalState = "committing"
+)
+
+type journalEntry struct {
+	Name string `json:"name"`
+	Url  string `json:"url"`
+	Hash string `json:"hash"`
+	Size int    `json:"size"`
+	Done bool   `json:"done"`
+}
+
+// journal records the planned file operations of an install or update and their completion state
+// inside the installation, so an interrupted run can be resumed or rolled back.
+type journal struct {
+	Operation string          `json:"operation"`
+	State     journalState    `json:"state"`
+	Stage     string          `json:"stage"`
+	Files     []*journalEntry `json:"files"`
+	Removals  []string        `json:"removals,omitempty"`
+	Keep      string          `json:"keep,omitempty"`
+	Snapshot  *Snapshot       `json:"snapshot,omitempty"`
+
+	path string
+	mu   sync.Mutex
+}
+
+func journalPath(path string) string {
+	return filepath.Join(path, StateDir, journalFile)
+}
+
+// readJournal reads the journal of the installation, a missing journal results in nil.
+func readJournal(path string) (*journal, error) {
+	f, err := os.Open(journalPath(path))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	j := &journal{path: path}
+	if err = json.NewDecoder(f).Decode(j); err != nil {
+		return nil, fmt.Errorf("broken journal %s: %w", journalPath(path), err)
+	}
+	return j, nil
+}
+
+// save atomically replaces the journal file, the caller has to hold the lock.
+func (j *journal) save() error {
+	jpath := journalPath(j.path)
+	if err := os.MkdirAll(filepath.Dir(jpath), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(jpath), journalFile+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(j); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), jpath)
+}
+
+func (j *journal) delete() {
+	if err := os.Remove(journalPath(j.path)); err != nil && !os.IsNotExist(err) {
+		logging.WarnLogger.Printf("unable to delete journal: %v", err)
+	}
+}
+
+// matches reports whether the journal planned the same operation on the same files.
+func (j *journal) matches(op string, files []*cdn.File) bool {
+	if j.Operation != op || len(j.Files) != len(files) {
+		return false
+	}
+
+	planned := make(map[string]*journalEntry, len(j.Files))
+	for _, entry := range j.Files {
+		planned[entry.Name] = entry
+	}
+	for _, file := range files {
+		entry, ok := planned[file.Name]
+		if !ok || entry.Hash != file.Hash || entry.Url != file.Url {
+			return false
+		}
+	}
+	return true
+}
+
+// done marks the file as downloaded and verified.
+func (j *journal) done(file *cdn.File) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for _, entry := range j.Files {
+		if entry.Name == file.Name {
+			entry.Done = true
+		}
+	}
+	if err := j.save(); err != nil {
+		logging.WarnLogger.Printf("unable to update journal: %v", err)
+	}
+}
+
+// recoverJournal finishes an interrupted commit of the installation and returns the journal of an interrupted download, if any.
+func recoverJournal(path string) (*journal, error) {
+	j, err := readJournal(path)
+	if err != nil || j == nil {
+		return nil, err
+	}
+
+	if _, err = os.Stat(j.Stage); errors.Is(err, fs.ErrNotExist) {
+		logging.WarnLogger.Printf("staging directory of unfinished %s is gone, discarding journal", j.Operation)
+		j.delete()
+		return nil, nil
+	}
+
+	if j.State != journalCommitting {
+		return j, nil
+	}
+
+	logging.InfoLogger.Printf("finishing interrupted %s", j.Operation)
+	target, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := &transaction{
+		stage: &stage{
+			dir:      j.Stage,
+			target:   target,
+			removals: j.Removals,
+			keep:     j.Keep,
+		},
+		journal: j,
+	}
+	if err = tx.commit(); err != nil {
+		return nil, fmt.Errorf("unable to finish interrupted %s: %w", j.Operation, err)
+	}
+
+	return nil, nil
+}
+
+// transaction ties a stage to a journal, so an interrupted install or update can be resumed.
+type transaction struct {
+	*stage
+	journal  *journal
+	snapshot *Snapshot
+}
+
+// beginTransaction stages the given files for the operation. A pending journal of the same operation on the same files is resumed,
+// otherwise it is rolled back. The returned files still have to be downloaded.
+func beginTransaction(path, op string, files []*cdn.File, pending *journal) (*transaction, []*cdn.File, error) {
+	if pending != nil && pending.matches(op, files) {
+		target, err := filepath.Abs(path)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		done := make(map[string]bool, len(pending.Files))
+		for _, entry := range pending.Files {
+			done[entry.Name] = entry.Done
+		}
+
+		tx := &transaction{
+			stage:   &stage{dir: pending.Stage, target: target},
+			journal: pending,
+		}
+
+		remaining := make([]*cdn.File, 0, len(files))
+		for _, file := range files {
+			staged, err := resolvePath(tx.dir, file.Name)
+			if err != nil {
+				return nil, nil, err
+			}
+			if _, err = os.Stat(staged); done[file.Name] && err == nil {
+				continue
+			}
+			remaining = append(remaining, file)
+		}
+
+		logging.InfoLogger.Printf("resuming interrupted %s, %d of %d files already downloaded", op, len(files)-len(remaining), len(files))
+		return tx, remaining, nil
+	}
+
+	if pending != nil {
+		logging.InfoLogger.Printf("rolling back unfinished %s", pending.Operation)
+		(&stage{dir: pending.Stage}).discard()
+		pending.delete()
+	}
+
+	st, err := newStage(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	j := &journal{
+		Operation: op,
+		State:     journalDownloading,
+		Stage:     st.dir,
+		Files:     make([]*journalEntry, len(files)),
+		path:      path,
+	}
+	for i, file := range files {
+		j.Files[i] = &journalEntry{
+			Name: file.Name,
+			Url:  file.Url,
+			Hash: file.Hash,
+			Size: file.Size,
+		}
+	}
+
+	if err = j.save(); err != nil {
+		st.discard()
+		return nil, nil, fmt.Errorf("unable to write journal: %w", err)
+	}
+
+	return &transaction{stage: st, journal: j}, files, nil
+}
+
+// keepSnapshot keeps the files replaced by the commit in the given snapshot.
+func (tx *transaction) keepSnapshot(store *snapshotStore, snap *Snapshot) {
+	tx.snapshot = snap
+	tx.keepBackup(store.files(snap))
+}
+
+// commit records the commit in the journal before moving the staged files into the installation.
+// The stage is discarded afterwards.
+func (tx *transaction) commit() error {
+	tx.journal.mu.Lock()
+	tx.journal.State = journalCommitting
+	tx.journal.Removals = tx.removals
+	tx.journal.Keep = tx.keep
+	if tx.snapshot != nil {
+		tx.journal.Snapshot = tx.snapshot
+	}
+	err := tx.journal.save()
+	tx.journal.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("unable to update journal: %w", err)
+	}
+
+	err = tx.stage.commit()
+	if errors.Is(err, errCommitPending) {
+		// the stage and the journal are kept, so the next run resumes the commit once more
+		return err
+	}
+	defer tx.discard()
+	if err != nil {
+		// the stage restored the installation, nothing left to resume
+		tx.journal.delete()
+		return err
+	}
+
+	if snap := tx.journal.Snapshot; snap != nil {
+		store := &snapshotStore{path: tx.journal.path}
+		if err = store.write(snap); err != nil {
+			// without its metadata the snapshot is neither listed nor pruned, drop the backup instead of leaking it
+			logging.WarnLogger.Printf("unable to write snapshot %s, discarding it: %v", snap.ID, err)
+			if err = os.RemoveAll(store.dir(snap)); err != nil {
+				logging.WarnLogger.Printf("unable to remove snapshot %s: %v", snap.ID, err)
+			}
+		} else {
+			logging.InfoLogger.Printf("created snapshot %s", snap.ID)
+		}
+	}
+
+	tx.journal.delete()
+	return nil
+}
+
+// resumable reports whether the error interrupted the transfer, e.g. by cancellation or a dropped connection, rather than failing it.
+func resumable(err error) bool {
+	var netErr net.Error
+	var interrupted *errInterrupted
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &netErr) || errors.As(err, &interrupted)
+}
+
+// abort keeps the stage and journal for a later resume if the operation was interrupted, otherwise both are discarded.
+func (tx *transaction) abort(err error) {
+	if resumable(err) {
+		logging.WarnLogger.Printf("%s interrupted, run it again to resume", tx.journal.Operation)
+		return
+	}
+
+	tx.discard()
+	tx.journal.delete()
+}
@@ -0,0 +1,213 @@
+package vcs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/timo972/altv-cli/pkg/cdn"
+)
+
+func TestJournalMatches(t *testing.T) {
+	j := &journal{
+		Operation: "update",
+		Files: []*journalEntry{
+			{Name: "altv-server", Url: "https://cdn/altv-server", Hash: "a1"},
+			{Name: "modules/js-module.so", Url: "https://cdn/js-module.so", Hash: "b1", Done: true},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		op    string
+		files []*cdn.File
+		want  bool
+	}{
+		{"same files", "update", []*cdn.File{
+			{Name: "modules/js-module.so", Url: "https://cdn/js-module.so", Hash: "b1"},
+			{Name: "altv-server", Url: "https://cdn/altv-server", Hash: "a1"},
+		}, true},
+		{"other operation", "install", []*cdn.File{
+			{Name: "altv-server", Url: "https://cdn/altv-server", Hash: "a1"},
+			{Name: "modules/js-module.so", Url: "https://cdn/js-module.so", Hash: "b1"},
+		}, false},
+		{"missing file", "update", []*cdn.File{
+			{Name: "altv-server", Url: "https://cdn/altv-server", Hash: "a1"},
+		}, false},
+		{"other file", "update", []*cdn.File{
+			{Name: "altv-server", Url: "https://cdn/altv-server", Hash: "a1"},
+			{Name: "modules/csharp-module.so", Url: "https://cdn/csharp-module.so", Hash: "b1"},
+		}, false},
+		{"changed hash", "update", []*cdn.File{
+			{Name: "altv-server", Url: "https://cdn/altv-server", Hash: "a2"},
+			{Name: "modules/js-module.so", Url: "https://cdn/js-module.so", Hash: "b1"},
+		}, false},
+		{"changed url", "update", []*cdn.File{
+			{Name: "altv-server", Url: "https://mirror/altv-server", Hash: "a1"},
+			{Name: "modules/js-module.so", Url: "https://cdn/js-module.so", Hash: "b1"},
+		}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := j.matches(tt.op, tt.files); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResumable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"canceled", fmt.Errorf("download failed: %w", context.Canceled), true},
+		{"timeout", context.DeadlineExceeded, true},
+		{"unexpected eof", io.ErrUnexpectedEOF, true},
+		{"network", &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}, true},
+		{"interrupted", &errInterrupted{e: errors.New("stalled")}, true},
+		{"checksum", errors.New("checksum mismatch"), false},
+		{"no cdn", newErrNoCDN("voice"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resumable(tt.err); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecoverJournal(t *testing.T) {
+	tests := []struct {
+		name  string
+		state journalState
+		// noStage removes the staging directory before recovering.
+		noStage bool
+		// resume is whether the journal is returned to resume the download.
+		resume bool
+		want   map[string]string
+	}{
+		{"finishes an interrupted commit", journalCommitting, false, false, map[string]string{"altv-server": "new", "server.toml": "config"}},
+		{"resumes an interrupted download", journalDownloading, false, true, map[string]string{"altv-server": "old", "server.toml": "config"}},
+		{"discards a journal without stage", journalDownloading, true, false, map[string]string{"altv-server": "old", "server.toml": "config"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := filepath.Join(t.TempDir(), "server")
+			writeTree(t, target, map[string]string{"altv-server": "old", "server.toml": "config"})
+
+			st, err := newStage(target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer st.discard()
+			writeTree(t, st.dir, map[string]string{"altv-server": "new"})
+			if tt.noStage {
+				st.discard()
+			}
+
+			j := &journal{
+				Operation: "update",
+				State:     tt.state,
+				Stage:     st.dir,
+				Files:     []*journalEntry{{Name: "altv-server", Hash: "a1", Done: true}},
+				path:      target,
+			}
+			if err = j.save(); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := recoverJournal(target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (got != nil) != tt.resume {
+				t.Fatalf("got journal %v, want resume %v", got, tt.resume)
+			}
+			if got != nil && (got.Stage != st.dir || len(got.Files) != 1 || !got.Files[0].Done) {
+				t.Errorf("unexpected journal %+v", got)
+			}
+
+			files := readInstallation(t, target)
+			if !maps.Equal(files, tt.want) {
+				t.Errorf("got installation %v, want %v", files, tt.want)
+			}
+
+			_, err = os.Stat(journalPath(target))
+			if exists := err == nil; exists != tt.resume {
+				t.Errorf("journal exists %v, want %v", exists, tt.resume)
+			}
+		})
+	}
+}
+
+func TestRecoverJournalCommitFails(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "server")
+	st, err := newStage(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.discard()
+
+	// the interrupted commit replaced a.bin, b.bin and c/file are still staged
+	// and c/file can not be moved into place, as c is a file
+	writeTree(t, target, map[string]string{"a.bin": "new a", "b.bin": "old b", "c": "blocker", "server.toml": "config"})
+	writeTree(t, st.backupDir(), map[string]string{"a.bin": "old a"})
+	writeTree(t, st.dir, map[string]string{"b.bin": "new b", "c/file": "new c"})
+
+	j := &journal{
+		Operation: "update",
+		State:     journalCommitting,
+		Stage:     st.dir,
+		Files:     []*journalEntry{{Name: "a.bin", Done: true}, {Name: "b.bin", Done: true}, {Name: "c/file", Done: true}},
+		path:      target,
+	}
+	if err = j.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = recoverJournal(target)
+	if !errors.Is(err, errCommitPending) {
+		t.Fatalf("got %v, want %v", err, errCommitPending)
+	}
+
+	// nothing of the interrupted commit is lost, it can be resumed once more
+	want := map[string]string{"a.bin": "new a", "b.bin": "old b", "c": "blocker", "server.toml": "config"}
+	if got := readInstallation(t, target); !maps.Equal(got, want) {
+		t.Errorf("got installation %v, want %v", got, want)
+	}
+	if got := readTree(t, st.backupDir()); !maps.Equal(got, map[string]string{"a.bin": "old a"}) {
+		t.Errorf("got backup %v", got)
+	}
+	if got := readTree(t, st.dir); !maps.Equal(got, map[string]string{"b.bin": "new b", "c/file": "new c"}) {
+		t.Errorf("got stage %v", got)
+	}
+	if _, err = os.Stat(journalPath(target)); err != nil {
+		t.Fatalf("journal removed: %v", err)
+	}
+
+	if err = os.Remove(filepath.Join(target, "c")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = recoverJournal(target); err != nil {
+		t.Fatal(err)
+	}
+	want = map[string]string{"a.bin": "new a", "b.bin": "new b", "c/file": "new c", "server.toml": "config"}
+	if got := readInstallation(t, target); !maps.Equal(got, want) {
+		t.Errorf("got installation %v, want %v", got, want)
+	}
+	if _, err = os.Stat(st.backupDir()); err == nil {
+		t.Error("backup directory left behind")
+	}
+}
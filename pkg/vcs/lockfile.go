@@ -0,0 +1,106 @@
+package vcs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+
+	"github.com/timo972/altv-cli/pkg/cdn"
+	"github.com/timo972/altv-cli/pkg/platform"
+	"github.com/timo972/altv-cli/pkg/version"
+)
+
+// LockfileName is the name of the lockfile written into the installation by install and update.
+const LockfileName = "altv.lock"
+
+// LockedModule pins the exact build of a module.
+type LockedModule struct {
+	Branch      version.Branch    `json:"branch"`
+	Arch        platform.Arch     `json:"arch"`
+	CDN         string            `json:"cdn"`
+	Version     string            `json:"version"`
+	BuildNumber int               `json:"buildNumber"`
+	SDKVersion  string            `json:"sdkVersion"`
+	HashList    map[string]string `json:"hashList"`
+}
+
+// Lockfile records the installed build of every module, so the same installation can be reproduced on other machines.
+type Lockfile struct {
+	Modules map[string]*LockedModule `json:"modules"`
+}
+
+// ReadLockfile reads the lockfile of the installation at path.
+func ReadLockfile(path string) (*Lockfile, error) {
+	f, err := os.Open(filepath.Join(path, LockfileName))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lock Lockfile
+	if err = json.NewDecoder(f).Decode(&lock); err != nil {
+		return nil, fmt.Errorf("broken lockfile: %w", err)
+	}
+	if lock.Modules == nil {
+		lock.Modules = map[string]*LockedModule{}
+	}
+
+	return &lock, nil
+}
+
+// readOrNewLockfile reads the lockfile of the installation or returns an empty one if there is none yet.
+func readOrNewLockfile(path string) (*Lockfile, error) {
+	lock, err := ReadLockfile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Lockfile{Modules: map[string]*LockedModule{}}, nil
+	}
+	return lock, err
+}
+
+// Write writes the lockfile into the directory at path.
+func (l *Lockfile) Write(path string) error {
+	f, err := os.OpenFile(filepath.Join(path, LockfileName), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(l)
+}
+
+// lock pins the module to the given manifest.
+func (l *Lockfile) lock(mod string, branch version.Branch, arch platform.Arch, c cdn.CDN, man *cdn.Manifest) {
+	l.Modules[mod] = &LockedModule{
+		Branch:      branch,
+		Arch:        arch,
+		CDN:         c.Name(),
+		Version:     man.Version,
+		BuildNumber: man.BuildNumber,
+		SDKVersion:  man.SDKVersion,
+		HashList:    maps.Clone(man.HashList),
+	}
+}
+
+// verify checks that the manifest matches the locked build of the module.
+func (l *Lockfile) verify(mod string, branch version.Branch, arch platform.Arch, man *cdn.Manifest) error {
+	locked, ok := l.Modules[mod]
+	switch {
+	case !ok:
+		return fmt.Errorf("module %s is not locked", mod)
+	case locked.Branch != branch:
+		return fmt.Errorf("module %s is locked to branch %s, got %s", mod, locked.Branch, branch)
+	case locked.Arch != arch:
+		return fmt.Errorf("module %s is locked to arch %s, got %s", mod, locked.Arch, arch)
+	case locked.Version != man.Version || locked.BuildNumber != man.BuildNumber:
+		return fmt.Errorf("module %s is locked to version %s (build %d), remote has %s (build %d)", mod, locked.Version, locked.BuildNumber, man.Version, man.BuildNumber)
+	case !maps.Equal(locked.HashList, man.HashList):
+		return fmt.Errorf("files of module %s differ from the locked version %s", mod, locked.Version)
+	}
+	return nil
+}
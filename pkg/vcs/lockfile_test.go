@@ -0,0 +1,97 @@
+package vcs
+
+import (
+	"testing"
+
+	"github.com/timo972/altv-cli/pkg/cdn"
+	"github.com/timo972/altv-cli/pkg/platform"
+	"github.com/timo972/altv-cli/pkg/version"
+)
+
+func TestLockfileVerify(t *testing.T) {
+	lock := &Lockfile{Modules: map[string]*LockedModule{
+		"server": {
+			Branch:      version.Branch("release"),
+			Arch:        platform.Arch("x64_linux"),
+			CDN:         "https://cdn.alt-mp.com",
+			Version:     "16.0.1",
+			BuildNumber: 1234,
+			HashList:    map[string]string{"altv-server": "a1", "data/clothes.bin": "b1"},
+		},
+	}}
+	locked := func() *cdn.Manifest {
+		return &cdn.Manifest{
+			Version:     "16.0.1",
+			BuildNumber: 1234,
+			HashList:    map[string]string{"altv-server": "a1", "data/clothes.bin": "b1"},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		module  string
+		branch  version.Branch
+		arch    platform.Arch
+		man     func() *cdn.Manifest
+		wantErr bool
+	}{
+		{"same build", "server", "release", "x64_linux", locked, false},
+		{"module not locked", "js-module", "release", "x64_linux", locked, true},
+		{"other branch", "server", "dev", "x64_linux", locked, true},
+		{"other arch", "server", "release", "x64_win32", locked, true},
+		{"other version", "server", "release", "x64_linux", func() *cdn.Manifest {
+			man := locked()
+			man.Version = "16.0.2"
+			return man
+		}, true},
+		{"other build", "server", "release", "x64_linux", func() *cdn.Manifest {
+			man := locked()
+			man.BuildNumber = 1235
+			return man
+		}, true},
+		{"republished file", "server", "release", "x64_linux", func() *cdn.Manifest {
+			man := locked()
+			man.HashList["altv-server"] = "a2"
+			return man
+		}, true},
+		{"added file", "server", "release", "x64_linux", func() *cdn.Manifest {
+			man := locked()
+			man.HashList["modules/js-module.so"] = "c1"
+			return man
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := lock.verify(tt.module, tt.branch, tt.arch, tt.man())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verify error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLockfileWriteRead(t *testing.T) {
+	dir := t.TempDir()
+
+	lock, err := readOrNewLockfile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lock.Modules) != 0 {
+		t.Fatalf("new lockfile has %d modules", len(lock.Modules))
+	}
+
+	lock.Modules["server"] = &LockedModule{Branch: "release", Arch: "x64_linux", Version: "16.0.1", BuildNumber: 1234, HashList: map[string]string{"altv-server": "a1"}}
+	if err = lock.Write(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := ReadLockfile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = read.verify("server", "release", "x64_linux", &cdn.Manifest{Version: "16.0.1", BuildNumber: 1234, HashList: map[string]string{"altv-server": "a1"}}); err != nil {
+		t.Errorf("read lockfile differs: %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package vcs
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/timo972/altv-cli/pkg/cdn"
+)
+
+// readLocalManifest reads the manifest of the given module from the installation directory.
+func readLocalManifest(path, mod string) (*cdn.Manifest, error) {
+	f, err := os.Open(filepath.Join(path, cdn.ManifestFileName(mod)))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var man cdn.Manifest
+	if err = json.NewDecoder(f).Decode(&man); err != nil {
+		return nil, err
+	}
+
+	return &man, nil
+}
+
+// writeLocalManifest writes the manifest of the given module into the installation directory.
+func writeLocalManifest(path, mod string, man *cdn.Manifest) error {
+	f, err := os.OpenFile(filepath.Join(path, cdn.ManifestFileName(mod)), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(man)
+}
+
+// diffManifests returns the files that have to be downloaded to get from the old to the new manifest.
+// A nil old manifest results in every file of the new manifest being added.
+func diffManifests(old, new *cdn.Manifest) []*FileChange {
+	changes := make([]*FileChange, 0)
+	for name, hash := range new.HashList {
+		size := new.SizeList[name]
+		if old == nil {
+			changes = append(changes, &FileChange{Name: name, Change: FileAdded, Size: size})
+			continue
+		}
+
+		oldHash, ok := old.HashList[name]
+		switch {
+		case !ok:
+			changes = append(changes, &FileChange{Name: name, Change: FileAdded, Size: size})
+		case oldHash != hash, old.SizeList[name] != size:
+			changes = append(changes, &FileChange{Name: name, Change: FileModified, Size: size})
+		case hash == "" && old.Version != new.Version:
+			// files without checksum (e.g. github cdn) can only be compared by version
+			changes = append(changes, &FileChange{Name: name, Change: FileModified, Size: size})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+
+	return changes
+}
+
+// unchangedFiles returns the files of the manifest that are not part of the given changes.
+func unchangedFiles(man *cdn.Manifest, changes []*FileChange) []*FileChange {
+	changed := make(map[string]bool, len(changes))
+	for _, change := range changes {
+		changed[change.Name] = true
+	}
+
+	unchanged := make([]*FileChange, 0, len(man.HashList)-len(changes))
+	for name := range man.HashList {
+		if !changed[name] {
+			unchanged = append(unchanged, &FileChange{Name: name, Change: FileUnchanged, Size: man.SizeList[name], State: TransferSkipped})
+		}
+	}
+
+	sort.Slice(unchanged, func(i, j int) bool {
+		return unchanged[i].Name < unchanged[j].Name
+	})
+
+	return unchanged
+}
@@ -0,0 +1,118 @@
+package vcs
+
+import (
+	"testing"
+
+	"github.com/timo972/altv-cli/pkg/cdn"
+)
+
+func TestDiffManifests(t *testing.T) {
+	remote := &cdn.Manifest{
+		Version:  "16.0.1",
+		HashList: map[string]string{"altv-server": "b1", "data/clothes.bin": "c1", "modules/js-module.so": "d1"},
+		SizeList: map[string]int{"altv-server": 30, "data/clothes.bin": 20, "modules/js-module.so": 10},
+	}
+
+	tests := []struct {
+		name string
+		old  *cdn.Manifest
+		new  *cdn.Manifest
+		want []FileChange
+	}{
+		{
+			name: "no local manifest adds every file",
+			old:  nil,
+			new:  remote,
+			want: []FileChange{
+				{Name: "altv-server", Change: FileAdded, Size: 30},
+				{Name: "data/clothes.bin", Change: FileAdded, Size: 20},
+				{Name: "modules/js-module.so", Change: FileAdded, Size: 10},
+			},
+		},
+		{
+			name: "identical manifests",
+			old:  remote,
+			new:  remote,
+			want: []FileChange{},
+		},
+		{
+			name: "changed hash, changed size and new file",
+			old: &cdn.Manifest{
+				Version:  "16.0.0",
+				HashList: map[string]string{"altv-server": "b0", "data/clothes.bin": "c1", "removed.dll": "e1"},
+				SizeList: map[string]int{"altv-server": 30, "data/clothes.bin": 19, "removed.dll": 5},
+			},
+			new: remote,
+			want: []FileChange{
+				{Name: "altv-server", Change: FileModified, Size: 30},
+				{Name: "data/clothes.bin", Change: FileModified, Size: 20},
+				{Name: "modules/js-module.so", Change: FileAdded, Size: 10},
+			},
+		},
+		{
+			name: "files without checksum are compared by version",
+			old: &cdn.Manifest{
+				Version:  "1.0.0",
+				HashList: map[string]string{"modules/go-module.so": ""},
+				SizeList: map[string]int{"modules/go-module.so": 10},
+			},
+			new: &cdn.Manifest{
+				Version:  "1.1.0",
+				HashList: map[string]string{"modules/go-module.so": ""},
+				SizeList: map[string]int{"modules/go-module.so": 10},
+			},
+			want: []FileChange{
+				{Name: "modules/go-module.so", Change: FileModified, Size: 10},
+			},
+		},
+		{
+			name: "files without checksum of the same version",
+			old: &cdn.Manifest{
+				Version:  "1.1.0",
+				HashList: map[string]string{"modules/go-module.so": ""},
+				SizeList: map[string]int{"modules/go-module.so": 10},
+			},
+			new: &cdn.Manifest{
+				Version:  "1.1.0",
+				HashList: map[string]string{"modules/go-module.so": ""},
+				SizeList: map[string]int{"modules/go-module.so": 10},
+			},
+			want: []FileChange{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diffManifests(tt.old, tt.new)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d changes, want %d", len(got), len(tt.want))
+			}
+			for i, change := range got {
+				if *change != tt.want[i] {
+					t.Errorf("change %d: got %+v, want %+v", i, *change, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestUnchangedFiles(t *testing.T) {
+	man := &cdn.Manifest{
+		HashList: map[string]string{"altv-server": "b1", "data/clothes.bin": "c1", "modules/js-module.so": "d1"},
+		SizeList: map[string]int{"altv-server": 30, "data/clothes.bin": 20, "modules/js-module.so": 10},
+	}
+
+	got := unchangedFiles(man, []*FileChange{{Name: "data/clothes.bin", Change: FileModified, Size: 20}})
+	want := []FileChange{
+		{Name: "altv-server", Change: FileUnchanged, Size: 30, State: TransferSkipped},
+		{Name: "modules/js-module.so", Change: FileUnchanged, Size: 10, State: TransferSkipped},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d unchanged files, want %d", len(got), len(want))
+	}
+	for i, change := range got {
+		if *change != want[i] {
+			t.Errorf("file %d: got %+v, want %+v", i, *change, want[i])
+		}
+	}
+}
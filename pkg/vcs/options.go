@@ -0,0 +1,132 @@
+package vcs
+
+import (
+	"net/http"
+
+	"github.com/timo972/altv-cli/pkg/cache"
+	"github.com/timo972/altv-cli/pkg/retry"
+)
+
+const (
+	// DefaultConcurrency is the default number of files downloaded at once.
+	DefaultConcurrency = 8
+	// DefaultHostConcurrency is the default number of files downloaded at once from a single cdn host.
+	DefaultHostConcurrency = 4
+	// DefaultSegments is the default number of byte ranges large files are split into.
+	DefaultSegments = 4
+	// DefaultSegmentThreshold is the default size in bytes from which on files are downloaded in segments.
+	DefaultSegmentThreshold = 32 << 20
+)
+
+// Option configures a Downloader, Checker or Updater.
+type Option func(*options)
+
+type options struct {
+	concurrency      int
+	hostConcurrency  int
+	segments         int
+	segmentThreshold int
+	client           *http.Client
+	retry            retry.Policy
+	observer         Observer
+	cache            cache.Cache
+	offline          bool
+	rateLimit        int64
+	cdnRateLimits    map[string]int64
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		concurrency:      DefaultConcurrency,
+		hostConcurrency:  DefaultHostConcurrency,
+		segments:         DefaultSegments,
+		segmentThreshold: DefaultSegmentThreshold,
+		retry:            retry.DefaultPolicy,
+		observer:         nopObserver{},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithConcurrency limits the number of files downloaded at once, in total and per cdn host.
+// A limit <= 0 disables it.
+func WithConcurrency(total, perHost int) Option {
+	return func(o *options) {
+		o.concurrency = total
+		o.hostConcurrency = perHost
+	}
+}
+
+// WithSegments splits files of at least threshold bytes into n byte ranges which are downloaded concurrently.
+// Every segment opens its own connection and counts towards the per host limit of WithConcurrency, a file gets fewer segments if its host has no free slots.
+// n <= 1 disables segmented downloads.
+func WithSegments(n, threshold int) Option {
+	return func(o *options) {
+		o.segments = n
+		o.segmentThreshold = threshold
+	}
+}
+
+// WithHTTPClient sets the client files are downloaded with instead of the one of the registry, it should retry transient failures (see retry.NewTransport).
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *options) {
+		o.client = client
+	}
+}
+
+// WithRetry sets the policy for downloads interrupted while reading the response, they are resumed where they stopped.
+func WithRetry(policy retry.Policy) Option {
+	return func(o *options) {
+		o.retry = policy
+	}
+}
+
+// WithObserver reports the progress of downloads and verifications to the observer.
+func WithObserver(obs Observer) Option {
+	return func(o *options) {
+		o.observer = obs
+	}
+}
+
+// WithCache restores files from the cache before downloading them and adds downloaded files to it.
+// A nil cache disables caching, which is the default.
+func WithCache(c cache.Cache) Option {
+	return func(o *options) {
+		o.cache = c
+	}
+}
+
+// WithOffline resolves manifests and files only from the cache and the http client, which has to serve a local mirror
+// instead of the network then (see mirror.NewTransport). Downloads fail with a list of all missing files before any is written.
+func WithOffline() Option {
+	return func(o *options) {
+		o.offline = true
+	}
+}
+
+// WithRateLimit limits the combined throughput of all concurrent downloads to bytesPerSecond, <= 0 disables it.
+func WithRateLimit(bytesPerSecond int64) Option {
+	return func(o *options) {
+		o.rateLimit = bytesPerSecond
+	}
+}
+
+// WithCDNRateLimit additionally limits the combined throughput of all downloads from the cdn with the given name.
+func WithCDNRateLimit(name string, bytesPerSecond int64) Option {
+	return func(o *options) {
+		if o.cdnRateLimits == nil {
+			o.cdnRateLimits = make(map[string]int64)
+		}
+		o.cdnRateLimits[name] = bytesPerSecond
+	}
+}
+
+// registry wraps the registry to record manifests in the cache, or to resolve them from it offline.
+func (o options) registry(reg CDNRegistry) CDNRegistry {
+	if o.cache == nil {
+		return reg
+	}
+	return &cachedRegistry{CDNRegistry: reg, cache: o.cache, offline: o.offline}
+}
@@ -0,0 +1,71 @@
+package vcs
+
+import (
+	"context"
+	"sync"
+)
+
+// forEach calls fn for the indices 0 to n-1 with at most limit calls running at once (<= 0 = unlimited) and waits for all of them.
+// No further calls are started once the context is done. fn should write its result to the given index, which keeps the order deterministic.
+func forEach(ctx context.Context, n, limit int, fn func(i int)) {
+	if limit <= 0 || limit > n {
+		limit = n
+	}
+
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(limit)
+	for w := 0; w < limit; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				fn(i)
+			}
+		}()
+	}
+
+	for i := 0; i < n && ctx.Err() == nil; i++ {
+		select {
+		case indices <- i:
+		case <-ctx.Done():
+		}
+	}
+	close(indices)
+	wg.Wait()
+}
+
+// hostSlots limits the number of concurrent requests per host (<= 0 = unlimited).
+// The slots are shared by the download workers and the segments of their files, so segmented downloads keep to the same limit.
+type hostSlots struct {
+	mu    sync.Mutex
+	limit int
+	used  map[string]int
+}
+
+func newHostSlots(limit int) *hostSlots {
+	return &hostSlots{limit: limit, used: make(map[string]int)}
+}
+
+// acquire takes up to n free slots of the host and returns how many it took.
+func (s *hostSlots) acquire(host string, n int) int {
+	if s.limit <= 0 {
+		return n
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n = max(min(n, s.limit-s.used[host]), 0)
+	s.used[host] += n
+	return n
+}
+
+// release returns n slots of the host.
+func (s *hostSlots) release(host string, n int) {
+	if s.limit <= 0 || n == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.used[host] -= n
+}
@@ -0,0 +1,266 @@
+package vcs
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+
+	"github.com/timo972/altv-cli/pkg/cdn"
+	"github.com/timo972/altv-cli/pkg/extract"
+	"github.com/timo972/altv-cli/pkg/logging"
+)
+
+type FileState uint8
+
+const (
+	FileOK FileState = iota
+	FileMissing
+	FileSizeMismatch
+	FileHashMismatch
+	// FileUnverifiable is a present file of the expected size without checksum in the manifest (e.g. github cdn).
+	FileUnverifiable
+	// FileUpgradable is a valid file that differs from the remote manifest.
+	FileUpgradable
+)
+
+func (s FileState) String() string {
+	switch s {
+	case FileOK:
+		return "ok"
+	case FileMissing:
+		return "missing"
+	case FileSizeMismatch:
+		return "size mismatch"
+	case FileHashMismatch:
+		return "hash mismatch"
+	case FileUnverifiable:
+		return "unverifiable"
+	case FileUpgradable:
+		return "upgradable"
+	default:
+		return "unknown"
+	}
+}
+
+// Failed reports whether the file is missing or corrupted.
+func (s FileState) Failed() bool {
+	return s == FileMissing || s == FileSizeMismatch || s == FileHashMismatch
+}
+
+// FileReport is the verification result of a single file.
+type FileReport struct {
+	Name  string
+	State FileState
+	Err   error
+	// Archive is the manifest file the file was extracted from, empty for files listed in the manifest.
+	Archive string
+}
+
+// ModuleReport is the verification result of a module and all of its files.
+type ModuleReport struct {
+	Module string
+	// Version of the manifest the module was verified against.
+	Version string
+	Status  ModuleStatus
+	Files   []*FileReport
+}
+
+// Failed returns the missing or corrupted files of the module.
+func (r *ModuleReport) Failed() []*FileReport {
+	failed := make([]*FileReport, 0)
+	for _, file := range r.Files {
+		if file.State.Failed() {
+			failed = append(failed, file)
+		}
+	}
+	return failed
+}
+
+// Count returns the number of files in the given state.
+func (r *ModuleReport) Count(state FileState) int {
+	n := 0
+	for _, file := range r.Files {
+		if file.State == state {
+			n++
+		}
+	}
+	return n
+}
+
+// Missing reports whether none of the module files are installed.
+func (r *ModuleReport) Missing() bool {
+	return len(r.Files) > 0 && r.Count(FileMissing) == len(r.Files)
+}
+
+// Report maps every verified module to its verification result.
+type Report map[string]*ModuleReport
+
+// Status returns the status of every module.
+func (r Report) Status() ModuleStatusResult {
+	status := ModuleStatusResult{}
+	for mod, mr := range r {
+		status[mod] = mr.Status
+	}
+	return status
+}
+
+// Modules returns the names of all modules in the report, sorted.
+func (r Report) Modules() []string {
+	mods := make([]string, 0, len(r))
+	for mod := range r {
+		mods = append(mods, mod)
+	}
+	sort.Strings(mods)
+	return mods
+}
+
+// verifyManifest checks every file of the manifest in the installation and reports them to the observer.
+func verifyManifest(ctx context.Context, path, mod string, man *cdn.Manifest, obs Observer) *ModuleReport {
+	names := make([]string, 0, len(man.HashList))
+	for name := range man.HashList {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	report := &ModuleReport{
+		Module:  mod,
+		Version: man.Version,
+		Status:  StatusValid,
+		Files:   make([]*FileReport, len(names)),
+	}
+	for _, name := range names {
+		obs.Observe(Event{Type: EventFileQueued, Module: mod, File: name, Size: int64(man.SizeList[name])})
+	}
+	for i, name := range names {
+		if ctx.Err() != nil {
+			// only the files checked before the context was done are reported
+			report.Files = report.Files[:i]
+			return report
+		}
+		state, err := CheckFile(path, name, man.HashList[name], man.SizeList[name])
+		e := Event{Type: EventFileVerified, Module: mod, File: name, Size: int64(man.SizeList[name])}
+		if state.Failed() {
+			report.Status = StatusInvalid
+			e.Type = EventFileFailed
+			e.Err = err
+		}
+		obs.Observe(e)
+		report.Files[i] = &FileReport{Name: name, State: state, Err: err}
+	}
+
+	for _, name := range names {
+		if !extract.Supported(name) {
+			continue
+		}
+		for _, file := range verifyExtracted(path, name) {
+			if file.State.Failed() {
+				report.Status = StatusInvalid
+			}
+			report.Files = append(report.Files, file)
+		}
+	}
+
+	return report
+}
+
+// verifyExtracted checks the files recorded for the archive, archives extracted by older versions of the cli have no record and are skipped.
+func verifyExtracted(path, archive string) []*FileReport {
+	ex, err := readExtraction(path, archive)
+	if err != nil {
+		logging.WarnLogger.Printf("unable to read files extracted from %s: %v", archive, err)
+		return nil
+	} else if ex == nil {
+		return nil
+	}
+
+	reports := make([]*FileReport, len(ex.Files))
+	for i, file := range ex.Files {
+		state, err := CheckFile(path, file.Name, file.Hash, int(file.Size))
+		reports[i] = &FileReport{Name: file.Name, State: state, Err: err, Archive: archive}
+	}
+	return reports
+}
+
+// markUpgradable marks the files that differ between the local and the remote manifest of the module.
+func markUpgradable(report *ModuleReport, local, remote *cdn.Manifest) {
+	changes := diffManifests(local, remote)
+	if len(changes) == 0 && local.Version == remote.Version && local.BuildNumber == remote.BuildNumber {
+		report.Status = report.Status.Add(StatusUpToDate)
+		return
+	}
+	report.Status = report.Status.Add(StatusUpgradable)
+
+	files := make(map[string]*FileReport, len(report.Files))
+	for _, file := range report.Files {
+		files[file.Name] = file
+	}
+
+	for _, change := range changes {
+		file, ok := files[change.Name]
+		if !ok {
+			report.Files = append(report.Files, &FileReport{Name: change.Name, State: FileUpgradable})
+		} else if !file.State.Failed() {
+			file.State = FileUpgradable
+		}
+	}
+
+	sort.Slice(report.Files, func(i, j int) bool {
+		return report.Files[i].Name < report.Files[j].Name
+	})
+}
+
+// CheckFile verifies existence, size and checksum of the file in the installation.
+// A negative size skips the size check, an empty hash results in FileUnverifiable.
+func CheckFile(path, fname, fhash string, fsize int) (FileState, error) {
+	fpath, err := resolvePath(path, fname)
+	if err != nil {
+		return FileMissing, err
+	}
+
+	logging.DebugLogger.Printf("verifying file: %s", fpath)
+	file, err := os.Open(fpath)
+	if err != nil {
+		logging.DebugLogger.Printf("error while verifying file: could not open %s", fpath)
+		if errors.Is(err, fs.ErrNotExist) {
+			return FileMissing, err
+		}
+		return FileMissing, fmt.Errorf("can not open %s: %w", fpath, err)
+	}
+	defer file.Close()
+
+	if fsize >= 0 {
+		stat, err := file.Stat()
+		if err != nil {
+			logging.DebugLogger.Printf("file size read error for %s", fpath)
+			return FileMissing, err
+		}
+		if stat.Size() != int64(fsize) {
+			logging.DebugLogger.Printf("file size missmatch for %s: expected %d, got %d", fpath, fsize, stat.Size())
+			return FileSizeMismatch, fmt.Errorf("file size missmatch for %s: expected %d, got %d", fpath, fsize, stat.Size())
+		}
+	}
+
+	if fhash == "" {
+		return FileUnverifiable, nil
+	}
+
+	h := sha1.New()
+	if _, err := io.Copy(h, file); err != nil {
+		logging.DebugLogger.Printf("error while verifying file: could hash contents of %s", fpath)
+		return FileHashMismatch, err
+	}
+
+	checksum := hex.EncodeToString((h.Sum(nil)))
+	if checksum != fhash {
+		logging.DebugLogger.Printf("checksum missmatch for %s: expected %s, got %s", fpath, fhash, checksum)
+		return FileHashMismatch, fmt.Errorf("checksum missmatch for %s: expected %s, got %s", fpath, fhash, checksum)
+	}
+
+	return FileOK, nil
+}
@@ -0,0 +1,140 @@
+package vcs
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"testing"
+
+	"github.com/timo972/altv-cli/pkg/cdn"
+)
+
+func sha1Hex(content string) string {
+	sum := sha1.Sum([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestVerifyManifest(t *testing.T) {
+	path := t.TempDir()
+	writeTree(t, path, map[string]string{
+		"altv-server":          "server",
+		"data/clothes.bin":     "tampered",
+		"data/vehmodels.bin":   "short",
+		"modules/go-module.so": "go",
+	})
+
+	man := &cdn.Manifest{
+		Version: "16.0.1",
+		HashList: map[string]string{
+			"altv-server":          sha1Hex("server"),
+			"data/clothes.bin":     sha1Hex("original"),
+			"data/vehmodels.bin":   sha1Hex("vehmodels"),
+			"modules/go-module.so": "",
+			"modules/js-module.so": sha1Hex("js"),
+		},
+		SizeList: map[string]int{
+			"altv-server":          6,
+			"data/clothes.bin":     8,
+			"data/vehmodels.bin":   9,
+			"modules/go-module.so": 2,
+			"modules/js-module.so": 2,
+		},
+	}
+
+	report := verifyManifest(context.Background(), path, "server", man, nopObserver{})
+	if report.Module != "server" || report.Version != "16.0.1" {
+		t.Errorf("unexpected report of %s %s", report.Module, report.Version)
+	}
+	if !report.Status.Has(StatusInvalid) {
+		t.Errorf("expected status invalid, got %v", report.Status)
+	}
+
+	tests := []struct {
+		name  string
+		state FileState
+	}{
+		{"altv-server", FileOK},
+		{"data/clothes.bin", FileHashMismatch},
+		{"data/vehmodels.bin", FileSizeMismatch},
+		{"modules/go-module.so", FileUnverifiable},
+		{"modules/js-module.so", FileMissing},
+	}
+	if len(report.Files) != len(tests) {
+		t.Fatalf("got %d files, want %d", len(report.Files), len(tests))
+	}
+	for i, tt := range tests {
+		file := report.Files[i]
+		if file.Name != tt.name || file.State != tt.state {
+			t.Errorf("file %d: got %s %s, want %s %s", i, file.Name, file.State, tt.name, tt.state)
+		}
+		if (file.Err != nil) != tt.state.Failed() {
+			t.Errorf("%s: unexpected error %v", file.Name, file.Err)
+		}
+	}
+
+	if failed := report.Failed(); len(failed) != 3 {
+		t.Errorf("got %d failed files, want 3", len(failed))
+	}
+	if report.Missing() {
+		t.Error("module reported missing although files are installed")
+	}
+}
+
+func TestMarkUpgradable(t *testing.T) {
+	local := &cdn.Manifest{
+		Version:  "16.0.0",
+		HashList: map[string]string{"altv-server": "a1", "data/clothes.bin": "b1"},
+		SizeList: map[string]int{"altv-server": 1, "data/clothes.bin": 1},
+	}
+	remote := &cdn.Manifest{
+		Version:  "16.0.1",
+		HashList: map[string]string{"altv-server": "a2", "data/clothes.bin": "b1", "modules/js-module.so": "c1"},
+		SizeList: map[string]int{"altv-server": 1, "data/clothes.bin": 1, "modules/js-module.so": 1},
+	}
+
+	tests := []struct {
+		name   string
+		remote *cdn.Manifest
+		status ModuleStatus
+		states map[string]FileState
+	}{
+		{
+			name:   "up to date",
+			remote: local,
+			status: StatusValid | StatusUpToDate,
+			states: map[string]FileState{"altv-server": FileOK, "data/clothes.bin": FileOK},
+		},
+		{
+			name:   "changed and added files",
+			remote: remote,
+			status: StatusValid | StatusUpgradable,
+			states: map[string]FileState{"altv-server": FileUpgradable, "data/clothes.bin": FileOK, "modules/js-module.so": FileUpgradable},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := &ModuleReport{
+				Module: "server",
+				Status: StatusValid,
+				Files: []*FileReport{
+					{Name: "altv-server", State: FileOK},
+					{Name: "data/clothes.bin", State: FileOK},
+				},
+			}
+
+			markUpgradable(report, local, tt.remote)
+			if report.Status != tt.status {
+				t.Errorf("got status %v, want %v", report.Status, tt.status)
+			}
+			if len(report.Files) != len(tt.states) {
+				t.Fatalf("got %d files, want %d", len(report.Files), len(tt.states))
+			}
+			for _, file := range report.Files {
+				if state, ok := tt.states[file.Name]; !ok || file.State != state {
+					t.Errorf("%s: got %s, want %s", file.Name, file.State, state)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package vcs
+
+import (
+	"sync"
+
+	"github.com/timo972/altv-cli/pkg/cdn"
+)
+
+type ChangeType uint8
+
+const (
+	FileAdded ChangeType = iota
+	FileModified
+	FileRemoved
+	// FileUnchanged is a file that is identical in the local and the remote manifest and not downloaded again.
+	FileUnchanged
+)
+
+func (c ChangeType) String() string {
+	switch c {
+	case FileAdded:
+		return "added"
+	case FileModified:
+		return "modified"
+	case FileRemoved:
+		return "removed"
+	case FileUnchanged:
+		return "unchanged"
+	default:
+		return "unknown"
+	}
+}
+
+type TransferState uint8
+
+const (
+	// TransferPending is a file that has not been downloaded (yet), e.g. on dry runs or aborted downloads.
+	TransferPending TransferState = iota
+	TransferDownloaded
+	// TransferSkipped is a file that did not need to be downloaded, because it is unchanged or was downloaded by an interrupted run.
+	TransferSkipped
+	TransferFailed
+)
+
+func (s TransferState) String() string {
+	switch s {
+	case TransferPending:
+		return "pending"
+	case TransferDownloaded:
+		return "downloaded"
+	case TransferSkipped:
+		return "skipped"
+	case TransferFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// FileChange describes a single file installed, replaced or removed by an install, update or repair.
+type FileChange struct {
+	Name   string
+	Change ChangeType
+	// Size of the file in bytes, negative if unknown.
+	Size  int
+	State TransferState
+	// Err is the download error of a failed file.
+	Err error
+}
+
+// ModuleUpdate describes the changes an install, update or repair applied to a single module.
+type ModuleUpdate struct {
+	Module      string
+	FromVersion string
+	ToVersion   string
+	Files       []*FileChange
+}
+
+// Changed returns the files that were added, modified or removed.
+func (m *ModuleUpdate) Changed() []*FileChange {
+	changed := make([]*FileChange, 0, len(m.Files))
+	for _, file := range m.Files {
+		if file.Change != FileUnchanged {
+			changed = append(changed, file)
+		}
+	}
+	return changed
+}
+
+type UpdateResult []*ModuleUpdate
+
+// transferTracker records the download outcome of the added and modified files of a result.
+type transferTracker struct {
+	mu     sync.Mutex
+	files  map[string]*FileChange
+	done   func(*cdn.File)
+	closed bool
+}
+
+// newTracker marks all added and modified files of the result that are not part of remaining as skipped,
+// done is called for every file downloaded successfully.
+func (r UpdateResult) newTracker(remaining []*cdn.File, done func(*cdn.File)) *transferTracker {
+	t := &transferTracker{
+		files: make(map[string]*FileChange),
+		done:  done,
+	}
+	for _, mod := range r {
+		for _, file := range mod.Files {
+			if file.Change == FileAdded || file.Change == FileModified {
+				file.State = TransferSkipped
+				t.files[file.Name] = file
+			}
+		}
+	}
+	for _, file := range remaining {
+		if change, ok := t.files[file.Name]; ok {
+			change.State = TransferPending
+		}
+	}
+	return t
+}
+
+// finish records the outcome of a single download, downloads finishing after close are ignored.
+func (t *transferTracker) finish(file *cdn.File, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+
+	change, ok := t.files[file.Name]
+	if ok && err != nil {
+		change.State = TransferFailed
+		change.Err = err
+	} else if ok {
+		change.State = TransferDownloaded
+	}
+
+	if err == nil && t.done != nil {
+		t.done(file)
+	}
+}
+
+// close stops recording, the result can safely be read afterwards.
+func (t *transferTracker) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+}
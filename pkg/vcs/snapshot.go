@@ -0,0 +1,302 @@
+package vcs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/timo972/altv-cli/pkg/cdn"
+	"github.com/timo972/altv-cli/pkg/logging"
+)
+
+// StateDir is the directory inside an installation the cli keeps its own state in.
+const StateDir = ".altv"
+
+const snapshotMetaFile = "snapshot.json"
+const snapshotFilesDir = "files"
+
+// SnapshotModule records the version of a module before and after the update a snapshot was taken for.
+type SnapshotModule struct {
+	Module        string `json:"module" yaml:"module"`
+	Version       string `json:"version" yaml:"version"`
+	BuildNumber   int    `json:"buildNumber" yaml:"buildNumber"`
+	ToVersion     string `json:"toVersion" yaml:"toVersion"`
+	ToBuildNumber int    `json:"toBuildNumber" yaml:"toBuildNumber"`
+}
+
+// Snapshot holds the files and manifests an update replaced, so the update can be rolled back.
+type Snapshot struct {
+	ID      string            `json:"id" yaml:"id"`
+	Created time.Time         `json:"created" yaml:"created"`
+	Modules []*SnapshotModule `json:"modules" yaml:"modules"`
+}
+
+// Matches reports whether the snapshot was taken of the given id, module version or build number.
+func (s *Snapshot) Matches(to string) bool {
+	if s.ID == to {
+		return true
+	}
+	for _, mod := range s.Modules {
+		if mod.Version == to || (mod.Version != "" && strconv.Itoa(mod.BuildNumber) == to) {
+			return true
+		}
+	}
+	return false
+}
+
+type SnapshotStore interface {
+	// List returns all snapshots of the installation, oldest first.
+	List() ([]*Snapshot, error)
+	// Prune deletes all but the latest keep snapshots and returns the deleted ones.
+	Prune(keep int) ([]*Snapshot, error)
+	// Rollback restores the installation to the state before the latest snapshot, or before the snapshot matching to.
+	// Every snapshot newer than the target is rolled back as well and deleted afterwards.
+	Rollback(to string) ([]*Snapshot, Report, error)
+}
+
+type snapshotStore struct {
+	path string
+}
+
+func NewSnapshotStore(path string) SnapshotStore {
+	return &snapshotStore{path: path}
+}
+
+func snapshotsDir(path string) string {
+	return filepath.Join(path, StateDir, "snapshots")
+}
+
+// newSnapshot prepares a snapshot of the modules the given update plans change.
+func newSnapshot(path string, plans []*modulePlan) *Snapshot {
+	snap := &Snapshot{
+		ID:      time.Now().Format("20060102-150405"),
+		Created: time.Now(),
+		Modules: make([]*SnapshotModule, 0, len(plans)),
+	}
+
+	for i := 1; ; i++ {
+		if _, err := os.Stat(filepath.Join(snapshotsDir(path), snap.ID)); errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		snap.ID = fmt.Sprintf("%s-%d", snap.Created.Format("20060102-150405"), i)
+	}
+
+	for _, plan := range plans {
+		if !plan.changed() {
+			continue
+		}
+
+		mod := &SnapshotModule{
+			Module:        plan.update.Module,
+			ToVersion:     plan.remote.Version,
+			ToBuildNumber: plan.remote.BuildNumber,
+		}
+		if plan.local != nil {
+			mod.Version = plan.local.Version
+			mod.BuildNumber = plan.local.BuildNumber
+		}
+		snap.Modules = append(snap.Modules, mod)
+	}
+
+	return snap
+}
+
+func (s *snapshotStore) dir(snap *Snapshot) string {
+	return filepath.Join(snapshotsDir(s.path), snap.ID)
+}
+
+// files returns the directory the replaced files of the snapshot are kept in.
+func (s *snapshotStore) files(snap *Snapshot) string {
+	return filepath.Join(s.dir(snap), snapshotFilesDir)
+}
+
+func (s *snapshotStore) write(snap *Snapshot) error {
+	if err := os.MkdirAll(s.dir(snap), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filepath.Join(s.dir(snap), snapshotMetaFile), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(snap); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func (s *snapshotStore) List() ([]*Snapshot, error) {
+	entries, err := os.ReadDir(snapshotsDir(s.path))
+	if errors.Is(err, fs.ErrNotExist) {
+		return []*Snapshot{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	snaps := make([]*Snapshot, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		f, err := os.Open(filepath.Join(snapshotsDir(s.path), entry.Name(), snapshotMetaFile))
+		if err != nil {
+			logging.WarnLogger.Printf("skipping incomplete snapshot %s: %v", entry.Name(), err)
+			continue
+		}
+
+		var snap Snapshot
+		err = json.NewDecoder(f).Decode(&snap)
+		f.Close()
+		if err != nil {
+			logging.WarnLogger.Printf("skipping broken snapshot %s: %v", entry.Name(), err)
+			continue
+		}
+		snaps = append(snaps, &snap)
+	}
+
+	sort.Slice(snaps, func(i, j int) bool {
+		return snaps[i].Created.Before(snaps[j].Created)
+	})
+
+	return snaps, nil
+}
+
+func (s *snapshotStore) Prune(keep int) ([]*Snapshot, error) {
+	snaps, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	if keep < 0 {
+		keep = 0
+	}
+	if len(snaps) <= keep {
+		return []*Snapshot{}, nil
+	}
+
+	pruned := snaps[:len(snaps)-keep]
+	for _, snap := range pruned {
+		logging.DebugLogger.Printf("deleting snapshot %s", snap.ID)
+		if err = os.RemoveAll(s.dir(snap)); err != nil {
+			return nil, fmt.Errorf("unable to delete snapshot %s: %w", snap.ID, err)
+		}
+	}
+
+	return pruned, nil
+}
+
+func (s *snapshotStore) Rollback(to string) ([]*Snapshot, Report, error) {
+	snaps, err := s.List()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(snaps) == 0 {
+		return nil, nil, fmt.Errorf("no snapshots found in %s", s.path)
+	}
+
+	target := len(snaps) - 1
+	if to != "" {
+		for target >= 0 && !snaps[target].Matches(to) {
+			target--
+		}
+		if target < 0 {
+			return nil, nil, fmt.Errorf("no snapshot of version %s found", to)
+		}
+	}
+
+	applied := make([]*Snapshot, 0, len(snaps)-target)
+	report := Report{}
+	for i := len(snaps) - 1; i >= target; i-- {
+		logging.InfoLogger.Printf("rolling back snapshot %s", snaps[i].ID)
+		mreport, err := s.restore(snaps[i])
+		if err != nil {
+			return applied, report, fmt.Errorf("unable to roll back snapshot %s: %w", snaps[i].ID, err)
+		}
+
+		if err = os.RemoveAll(s.dir(snaps[i])); err != nil {
+			logging.WarnLogger.Printf("unable to delete snapshot %s: %v", snaps[i].ID, err)
+		}
+
+		applied = append(applied, snaps[i])
+		for mod, mr := range mreport {
+			report[mod] = mr
+		}
+	}
+
+	return applied, report, nil
+}
+
+// restore puts the files of the snapshot back into the installation, removes the files the update added and verifies the result.
+func (s *snapshotStore) restore(snap *Snapshot) (Report, error) {
+	st, err := newStage(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer st.discard()
+
+	files := s.files(snap)
+	if err = copyDir(files, st.dir); err != nil {
+		return nil, fmt.Errorf("unable to stage snapshot files: %w", err)
+	}
+
+	mans := make(map[string]*cdn.Manifest, len(snap.Modules))
+	for _, mod := range snap.Modules {
+		old, err := readLocalManifest(files, mod.Module)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("unable to read snapshot manifest of module %s: %w", mod.Module, err)
+		}
+
+		cur, err := readLocalManifest(s.path, mod.Module)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("unable to read manifest of module %s: %w", mod.Module, err)
+		}
+
+		if old == nil {
+			// the module did not exist before the update
+			st.remove(cdn.ManifestFileName(mod.Module))
+		}
+
+		if cur != nil {
+			for name := range cur.HashList {
+				if old == nil || !hasFile(old, name) {
+					st.remove(name)
+				}
+			}
+		}
+
+		if old != nil {
+			mans[mod.Module] = old
+		}
+	}
+
+	if err = st.commit(); err != nil {
+		return nil, err
+	}
+
+	report := Report{}
+	for mod, man := range mans {
+		report[mod] = verifyManifest(context.Background(), s.path, mod, man, nopObserver{})
+		for _, file := range report[mod].Failed() {
+			logging.WarnLogger.Printf("restored file %s of module %s is invalid: %v", file.Name, mod, file.Err)
+		}
+	}
+
+	return report, nil
+}
+
+func hasFile(man *cdn.Manifest, name string) bool {
+	_, ok := man.HashList[name]
+	return ok
+}
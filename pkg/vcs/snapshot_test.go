@@ -0,0 +1,121 @@
+package vcs
+
+import (
+	"maps"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/timo972/altv-cli/pkg/cdn"
+)
+
+// testManifest lists the given files, keyed by name, with the hash and size of their content.
+func testManifest(version string, build int, files map[string]string) *cdn.Manifest {
+	man := &cdn.Manifest{
+		BuildNumber: build,
+		Version:     version,
+		HashList:    make(map[string]string, len(files)),
+		SizeList:    make(map[string]int, len(files)),
+	}
+	for name, content := range files {
+		man.HashList[name] = sha1Hex(content)
+		man.SizeList[name] = len(content)
+	}
+	return man
+}
+
+func TestSnapshotRollback(t *testing.T) {
+	v1 := map[string]string{"altv-server": "v1"}
+	v2 := map[string]string{"altv-server": "v2", "modules/js-module.so": "js"}
+	v3 := map[string]string{"altv-server": "v3", "modules/js-module.so": "js", "modules/voice.so": "voice"}
+
+	tests := []struct {
+		name string
+		to   string
+		// want are the files of the installation after the rollback, without the manifest
+		want     map[string]string
+		wantVer  string
+		wantLeft int
+		wantErr  bool
+	}{
+		{"latest snapshot", "", v2, "16.0.2", 1, false},
+		{"older snapshot by version", "16.0.1", v1, "16.0.1", 0, false},
+		{"older snapshot by build", "1001", v1, "16.0.1", 0, false},
+		{"unknown version", "15.0.0", v3, "16.0.3", 2, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := t.TempDir()
+			store := &snapshotStore{path: path}
+
+			// the installation was updated from v1 to v2 and from v2 to v3, each update kept the files it replaced
+			history := []struct {
+				files    map[string]string
+				from, to *cdn.Manifest
+			}{
+				{v1, testManifest("16.0.1", 1001, v1), testManifest("16.0.2", 1002, v2)},
+				{v2, testManifest("16.0.2", 1002, v2), testManifest("16.0.3", 1003, v3)},
+			}
+			for i, h := range history {
+				snap := &Snapshot{
+					ID:      time.Unix(int64(i), 0).Format("20060102-150405"),
+					Created: time.Unix(int64(i), 0),
+					Modules: []*SnapshotModule{{
+						Module:        "server",
+						Version:       h.from.Version,
+						BuildNumber:   h.from.BuildNumber,
+						ToVersion:     h.to.Version,
+						ToBuildNumber: h.to.BuildNumber,
+					}},
+				}
+				replaced := make(map[string]string)
+				for name, content := range h.files {
+					if _, ok := h.to.HashList[name]; ok {
+						replaced[name] = content
+					}
+				}
+				writeTree(t, store.files(snap), replaced)
+				if err := writeLocalManifest(store.files(snap), "server", h.from); err != nil {
+					t.Fatal(err)
+				}
+				if err := store.write(snap); err != nil {
+					t.Fatal(err)
+				}
+			}
+			writeTree(t, path, v3)
+			if err := writeLocalManifest(path, "server", testManifest("16.0.3", 1003, v3)); err != nil {
+				t.Fatal(err)
+			}
+
+			_, report, err := store.Rollback(tt.to)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if err == nil && report["server"].Status != StatusValid {
+				t.Errorf("got status %v of the restored files", report["server"].Status)
+			}
+
+			got := readInstallation(t, path)
+			man, err := readLocalManifest(path, "server")
+			if err != nil {
+				t.Fatal(err)
+			}
+			delete(got, cdn.ManifestFileName("server"))
+			if !maps.Equal(got, tt.want) || man.Version != tt.wantVer {
+				t.Errorf("got version %s with files %v, want version %s with %v", man.Version, got, tt.wantVer, tt.want)
+			}
+
+			snaps, err := store.List()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(snaps) != tt.wantLeft {
+				t.Errorf("got %d snapshots left, want %d", len(snaps), tt.wantLeft)
+			}
+			if entries, _ := os.ReadDir(snapshotsDir(path)); len(entries) != tt.wantLeft {
+				t.Errorf("got %d snapshot directories, want %d", len(entries), tt.wantLeft)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package vcs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/timo972/altv-cli/pkg/logging"
+)
+
+// stage is a temporary directory inside the StateDir of the installation, files are downloaded into it
+// and only moved into the installation once every file has been downloaded and verified.
+// Keeping it inside the installation puts it on the same filesystem, even if the installation is a mount point, so the files can be renamed into place.
+type stage struct {
+	dir      string
+	target   string
+	removals []string
+	keep     string
+}
+
+// newStage creates a staging directory inside the given installation path.
+func newStage(target string) (*stage, error) {
+	target, err := filepath.Abs(target)
+	if err != nil {
+		return nil, err
+	}
+
+	state := filepath.Join(target, StateDir)
+	if err = os.MkdirAll(state, 0755); err != nil {
+		return nil, fmt.Errorf("can not create directory %s: %w", state, err)
+	}
+
+	dir, err := os.MkdirTemp(state, "staging-")
+	if err != nil {
+		return nil, fmt.Errorf("can not create staging directory: %w", err)
+	}
+	logging.DebugLogger.Printf("staging into %s", dir)
+
+	return &stage{
+		dir:    dir,
+		target: target,
+	}, nil
+}
+
+// remove schedules the deletion of the given installation file for the commit.
+func (s *stage) remove(names ...string) {
+	s.removals = append(s.removals, names...)
+}
+
+// keepBackup moves the files replaced or removed by the commit into dir instead of deleting them.
+func (s *stage) keepBackup(dir string) {
+	s.keep = dir
+}
+
+// backupDir returns the directory replaced files are moved into during the commit.
+func (s *stage) backupDir() string {
+	return s.dir + ".backup"
+}
+
+// errCommitPending is returned by commit if the commit of an interrupted stage failed once more.
+// The installation is left as the interrupted commit left it and its backup is kept, so the commit can be resumed again.
+var errCommitPending = errors.New("interrupted commit can not be finished")
+
+// stagedFiles returns the slash separated paths of all files in the staging directory, except partial downloads.
+func (s *stage) stagedFiles() ([]string, error) {
+	names := make([]string, 0)
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(d.Name(), partSuffix) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(rel))
+		return nil
+	})
+	return names, err
+}
+
+// commit moves all staged files into the installation and applies the scheduled removals.
+// Replaced files are kept in a backup directory until every file has been moved, on error the backup is restored.
+// If an interrupted commit is continued and fails, only the changes of this attempt are reverted and errCommitPending is returned.
+func (s *stage) commit() error {
+	names, err := s.stagedFiles()
+	if err != nil {
+		return fmt.Errorf("unable to read staging directory: %w", err)
+	}
+
+	// an existing backup directory belongs to an interrupted commit of this stage, which is continued
+	backup := s.backupDir()
+	_, err = os.Stat(backup)
+	resumed := err == nil
+	if err = os.MkdirAll(backup, 0755); err != nil {
+		return fmt.Errorf("can not create backup directory: %w", err)
+	}
+
+	moved := make([]string, 0, len(names))
+	replaced := make([]string, 0, len(names)+len(s.removals))
+
+	rollback := func(cause error) error {
+		restored := true
+		for i := len(moved) - 1; i >= 0; i-- {
+			dst, _ := resolvePath(s.target, moved[i])
+			src, _ := resolvePath(s.dir, moved[i])
+			if err := os.Rename(dst, src); err != nil {
+				logging.ErrLogger.Printf("unable to revert %s: %v", moved[i], err)
+			}
+		}
+		for i := len(replaced) - 1; i >= 0; i-- {
+			dst, _ := resolvePath(s.target, replaced[i])
+			src, _ := resolvePath(backup, replaced[i])
+			if err := os.Rename(src, dst); err != nil {
+				logging.ErrLogger.Printf("unable to restore %s: %v", replaced[i], err)
+				restored = false
+			}
+		}
+
+		// the backup holds the files replaced by the interrupted commit as well, which are only restored by resuming it
+		if resumed {
+			return fmt.Errorf("%w, replaced files are kept in %s: %w", errCommitPending, backup, cause)
+		}
+		if !restored {
+			return fmt.Errorf("commit failed, replaced files are kept in %s: %w", backup, cause)
+		}
+		if err := os.RemoveAll(backup); err != nil {
+			logging.WarnLogger.Printf("unable to remove backup directory %s: %v", backup, err)
+		}
+		return fmt.Errorf("commit failed, installation restored: %w", cause)
+	}
+
+	backupFile := func(name string) error {
+		dst, err := resolvePath(s.target, name)
+		if err != nil {
+			return err
+		}
+		if _, err = os.Lstat(dst); errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+
+		bak, err := resolvePath(backup, name)
+		if err != nil {
+			return err
+		}
+		if err = os.MkdirAll(filepath.Dir(bak), 0755); err != nil {
+			return err
+		}
+		if err = os.Rename(dst, bak); err != nil {
+			return err
+		}
+		replaced = append(replaced, name)
+		return nil
+	}
+
+	for _, name := range s.removals {
+		if err = backupFile(name); err != nil {
+			return rollback(fmt.Errorf("can not remove %s: %w", name, err))
+		}
+	}
+
+	for _, name := range names {
+		if err = backupFile(name); err != nil {
+			return rollback(fmt.Errorf("can not replace %s: %w", name, err))
+		}
+
+		src, _ := resolvePath(s.dir, name)
+		dst, err := resolvePath(s.target, name)
+		if err != nil {
+			return rollback(err)
+		}
+		if err = os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return rollback(fmt.Errorf("can not create directory for %s: %w", name, err))
+		}
+		if err = os.Rename(src, dst); err != nil {
+			return rollback(fmt.Errorf("can not move %s into place: %w", name, err))
+		}
+		moved = append(moved, name)
+	}
+
+	logging.DebugLogger.Printf("committed %d files, removed %d files", len(moved), len(s.removals))
+
+	for _, name := range s.removals {
+		if err = removeFile(s.target, name); err != nil {
+			logging.WarnLogger.Printf("unable to clean up after %s: %v", name, err)
+		}
+	}
+
+	if s.keep != "" {
+		if err = os.MkdirAll(filepath.Dir(s.keep), 0755); err == nil {
+			err = os.Rename(backup, s.keep)
+		}
+		if err == nil {
+			return nil
+		}
+		logging.WarnLogger.Printf("unable to keep replaced files in %s: %v", s.keep, err)
+	}
+
+	if err = os.RemoveAll(backup); err != nil {
+		logging.WarnLogger.Printf("unable to remove backup directory %s: %v", backup, err)
+	}
+
+	return nil
+}
+
+// discard deletes the staging directory and everything left in it.
+func (s *stage) discard() {
+	if err := os.RemoveAll(s.dir); err != nil {
+		logging.WarnLogger.Printf("unable to remove staging directory %s: %v", s.dir, err)
+	}
+}
@@ -0,0 +1,133 @@
+package vcs
+
+import (
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTree writes the files, keyed by slash separated path, into dir.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readTree returns the content of all files in dir, keyed by slash separated path.
+func readTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// readInstallation returns the files of the installation in dir like readTree, without the StateDir.
+func readInstallation(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := readTree(t, dir)
+	maps.DeleteFunc(files, func(name, _ string) bool {
+		return strings.HasPrefix(name, StateDir+"/")
+	})
+	return files
+}
+
+func TestStageCommit(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   map[string]string
+		staged   map[string]string
+		removals []string
+		// want is the installation after the commit, nil if the commit fails and the installation has to be restored.
+		want map[string]string
+	}{
+		{
+			name:     "replaces, adds and removes files",
+			target:   map[string]string{"altv-server": "old", "server.toml": "config", "modules/gone.so": "gone"},
+			staged:   map[string]string{"altv-server": "new", "modules/js-module.so": "new"},
+			removals: []string{"modules/gone.so"},
+			want:     map[string]string{"altv-server": "new", "server.toml": "config", "modules/js-module.so": "new"},
+		},
+		{
+			// modules is a file, so moving the old modules/libnode.so into the backup fails after altv-server has been moved
+			name:   "rolls back a failed replacement",
+			target: map[string]string{"altv-server": "old", "modules": "file"},
+			staged: map[string]string{"altv-server": "new", "modules/libnode.so": "new"},
+		},
+		{
+			name:     "rolls back a failed removal",
+			target:   map[string]string{"altv-server": "old", "data/vehmodels.bin": "data", "modules": "file"},
+			staged:   map[string]string{"altv-server": "new"},
+			removals: []string{"data/vehmodels.bin", "modules/gone.so"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := filepath.Join(t.TempDir(), "server")
+			writeTree(t, target, tt.target)
+
+			st, err := newStage(target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer st.discard()
+			// nothing is created next to the installation, its parent might not be writable
+			if entries, _ := os.ReadDir(filepath.Dir(target)); len(entries) != 1 {
+				t.Errorf("got %d entries next to the installation, want none", len(entries)-1)
+			}
+			writeTree(t, st.dir, tt.staged)
+			st.remove(tt.removals...)
+
+			err = st.commit()
+			if tt.want == nil {
+				if err == nil {
+					t.Fatal("expected the commit to fail")
+				}
+				if got := readInstallation(t, target); !maps.Equal(got, tt.target) {
+					t.Errorf("installation not restored, got %v, want %v", got, tt.target)
+				}
+				if got := readTree(t, st.dir); !maps.Equal(got, tt.staged) {
+					t.Errorf("staged files not restored, got %v, want %v", got, tt.staged)
+				}
+			} else {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := readInstallation(t, target); !maps.Equal(got, tt.want) {
+					t.Errorf("got installation %v, want %v", got, tt.want)
+				}
+			}
+
+			if _, err = os.Stat(st.backupDir()); err == nil {
+				t.Errorf("backup directory %s left behind", st.backupDir())
+			}
+		})
+	}
+}
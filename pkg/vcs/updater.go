@@ -2,29 +2,56 @@ package vcs
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"sort"
 
 	"github.com/timo972/altv-cli/pkg/cdn"
+	"github.com/timo972/altv-cli/pkg/extract"
 	"github.com/timo972/altv-cli/pkg/logging"
 	"github.com/timo972/altv-cli/pkg/platform"
 	"github.com/timo972/altv-cli/pkg/version"
 )
 
+type UpdateOptions struct {
+	// Prune deletes files that were removed from the remote manifest of a module.
+	Prune bool
+	// DryRun only plans the update without touching the installation.
+	DryRun bool
+	// Snapshot keeps the replaced files and manifests, so the update can be rolled back.
+	Snapshot bool
+}
+
 type Updater interface {
 	AddCDN(cdn.CDN)
-	Update(ctx context.Context, path string) error
+	Update(ctx context.Context, path string, opts UpdateOptions) (UpdateResult, error)
+	// Repair re-downloads the files failing verification and verifies the installation again.
+	Repair(ctx context.Context, path string) (UpdateResult, Report, error)
 }
 
 type updater struct {
-	check Checker
-	dl    Downloader
-	reg   CDNRegistry
+	check   Checker
+	dl      *downloader
+	reg     CDNRegistry
+	arch    platform.Arch
+	branch  version.Branch
+	modules []string
+	opts    options
 }
 
-func NewUpdater(arch platform.Arch, branch version.Branch, modules []string, reg CDNRegistry) Updater {
+func NewUpdater(arch platform.Arch, branch version.Branch, modules []string, reg CDNRegistry, opts ...Option) Updater {
+	o := newOptions(opts)
 	u := &updater{
-		check: NewChecker(arch, branch, modules, reg),
-		dl:    NewDownloader(arch, branch, modules, reg),
-		reg:   reg,
+		check:   NewChecker(arch, branch, modules, reg, opts...),
+		dl:      NewDownloader(arch, branch, modules, reg, opts...).(*downloader),
+		reg:     o.registry(reg),
+		arch:    arch,
+		branch:  branch,
+		modules: modules,
+		opts:    o,
 	}
 
 	return u
@@ -34,13 +61,457 @@ func (u *updater) AddCDN(cdn cdn.CDN) {
 	u.reg.AddCDN(cdn)
 }
 
-func (u *updater) Update(ctx context.Context, path string) error {
-	status, err := u.check.Verify(ctx, path, true)
+// modulePlan holds everything needed to update a single module.
+type modulePlan struct {
+	cdn    cdn.CDN
+	update *ModuleUpdate
+	local  *cdn.Manifest
+	remote *cdn.Manifest
+	files  []*cdn.File
+	stale  []string
+}
+
+// changed reports whether the local manifest of the module has to be rewritten.
+func (p *modulePlan) changed() bool {
+	return p.local == nil || len(p.update.Changed()) > 0 || p.local.Version != p.remote.Version || p.local.BuildNumber != p.remote.BuildNumber
+}
+
+// planModule compares the local manifest of the module with the remote one and returns the files that need to be downloaded.
+func (u *updater) planModule(ctx context.Context, path, mod string) (*modulePlan, error) {
+	c, ok := u.reg.moduleCDN(mod)
+	if !ok {
+		return nil, newErrNoCDN(mod)
+	}
+	logging.DebugLogger.Printf("cdn %v for module %s", c, mod)
+
+	// the files are resolved with the manifest, so they always belong to the version planned
+	rman, mfiles, err := c.Files(ctx, u.branch, u.arch, mod, false)
+	if err != nil {
+		return nil, newErrNoManifest(mod, err)
+	}
+
+	lman, err := readLocalManifest(path, mod)
+	if errors.Is(err, fs.ErrNotExist) {
+		logging.DebugLogger.Printf("no local manifest for module %s, updating all files", mod)
+	} else if err != nil {
+		logging.WarnLogger.Printf("unable to read local manifest for module %s, updating all files: %v", mod, err)
+	}
+
+	changes := diffManifests(lman, rman)
+	plan := &modulePlan{
+		cdn: c,
+		update: &ModuleUpdate{
+			Module:    mod,
+			ToVersion: rman.Version,
+			Files:     append(changes, unchangedFiles(rman, changes)...),
+		},
+		local:  lman,
+		remote: rman,
+	}
+	if lman != nil {
+		plan.update.FromVersion = lman.Version
+	}
+
+	if len(changes) == 0 {
+		return plan, nil
+	}
+
+	index := make(map[string]*cdn.File, len(mfiles))
+	for _, file := range mfiles {
+		index[file.Name] = file
+	}
+
+	plan.files = make([]*cdn.File, len(changes))
+	for i, change := range changes {
+		file, ok := index[change.Name]
+		if !ok {
+			return nil, fmt.Errorf("file %s of module %s is missing on the cdn", change.Name, mod)
+		}
+		plan.files[i] = file
+	}
+
+	return plan, nil
+}
+
+// Update downloads only the files that changed between the local and the remote manifest of every module and writes the new manifests afterwards.
+// Files that no longer exist in the remote manifest are deleted if opts.Prune is set.
+// All changes are staged and applied at once, the installation is left untouched on error.
+// An interrupted update of the same files is resumed.
+func (u *updater) Update(ctx context.Context, path string, opts UpdateOptions) (UpdateResult, error) {
+	var pending *journal
+	if !opts.DryRun {
+		var err error
+		if pending, err = recoverJournal(path); err != nil {
+			return nil, err
+		}
+	}
+
+	planned := make([]*modulePlan, len(u.modules))
+	failed := make([]error, len(u.modules))
+	forEach(ctx, len(u.modules), u.opts.concurrency, func(i int) {
+		planned[i], failed[i] = u.planModule(ctx, path, u.modules[i])
+		if failed[i] != nil {
+			logging.WarnLogger.Printf(failed[i].Error())
+		}
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make(UpdateResult, 0, len(u.modules))
+	plans := make([]*modulePlan, 0, len(u.modules))
+	files := make([]*cdn.File, 0)
+	errs := make([]error, 0)
+	for i, plan := range planned {
+		if failed[i] != nil {
+			errs = append(errs, failed[i])
+			continue
+		}
+
+		logging.DebugLogger.Printf("%d changed files for module %s", len(plan.files), u.modules[i])
+		result = append(result, plan.update)
+		plans = append(plans, plan)
+		files = append(files, plan.files...)
+	}
+
+	if len(result) == 0 && len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	if opts.Prune {
+		installed, err := unplannedManifests(path, plans)
+		if err != nil {
+			return result, fmt.Errorf("unable to read manifests of installed modules: %w", err)
+		}
+		markStaleFiles(plans, installed)
+	}
+
+	if opts.DryRun {
+		logging.InfoLogger.Printf("dry run: would download %d changed files", len(files))
+		for _, plan := range plans {
+			for _, name := range plan.stale {
+				logging.InfoLogger.Printf("dry run: would delete %s (module %s)", name, plan.update.Module)
+			}
+		}
+		return result, joinPartial(errs)
+	}
+
+	tx, remaining, err := beginTransaction(path, "update", files, pending)
+	if err != nil {
+		return result, err
+	}
+
+	tracker := result.newTracker(remaining, tx.journal.done)
+	if len(remaining) > 0 {
+		logging.InfoLogger.Printf("downloading %d changed files", len(remaining))
+		err = u.dl.downloadFiles(ctx, tx.dir, remaining, tracker.finish)
+	}
+	tracker.close()
+	if err != nil {
+		tx.abort(err)
+		return result, err
+	}
+
+	for _, plan := range plans {
+		if plan.changed() {
+			if err = writeLocalManifest(tx.dir, plan.update.Module, plan.remote); err != nil {
+				tx.abort(err)
+				return result, fmt.Errorf("unable to write manifest of module %s: %w", plan.update.Module, err)
+			}
+		}
+
+		for _, name := range plan.stale {
+			logging.InfoLogger.Printf("deleting %s (module %s)", name, plan.update.Module)
+			tx.remove(name)
+		}
+
+		extracted, err := replacedExtractions(path, tx.dir, plan)
+		if err != nil {
+			tx.abort(err)
+			return result, err
+		}
+		for _, name := range extracted {
+			logging.DebugLogger.Printf("deleting %s (module %s)", name, plan.update.Module)
+			tx.remove(name)
+		}
+	}
+
+	lock, err := readOrNewLockfile(path)
 	if err != nil {
-		return err
+		tx.abort(err)
+		return result, err
+	}
+	for _, plan := range plans {
+		lock.lock(plan.update.Module, u.branch, u.arch, plan.cdn, plan.remote)
+	}
+	if err = lock.Write(tx.dir); err != nil {
+		tx.abort(err)
+		return result, fmt.Errorf("unable to write %s: %w", LockfileName, err)
+	}
+
+	if opts.Snapshot && slices.ContainsFunc(plans, (*modulePlan).changed) {
+		tx.keepSnapshot(&snapshotStore{path: path}, newSnapshot(path, plans))
 	}
 
-	logging.DebugLogger.Printf("status: %v", status)
+	if err = tx.commit(); err != nil {
+		return result, err
+	}
+
+	return result, joinPartial(errs)
+}
+
+// unplannedManifests returns the local manifests of the installed modules without a plan, e.g. modules not updated or failed to resolve.
+func unplannedManifests(path string, plans []*modulePlan) ([]*cdn.Manifest, error) {
+	mans, _, err := aggregateLocalManifests(path)
+	if errors.Is(err, fs.ErrNotExist) && len(mans) == 0 {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	unplanned := make([]*cdn.Manifest, 0, len(mans))
+	for _, man := range mans {
+		if !slices.ContainsFunc(plans, func(plan *modulePlan) bool { return plan.update.Module == man.mod }) {
+			unplanned = append(unplanned, man.Manifest)
+		}
+	}
+	return unplanned, nil
+}
+
+// markStaleFiles collects the files of every module which are listed in the local but not in the remote manifest.
+// Files still referenced by another planned or installed module are kept.
+func markStaleFiles(plans []*modulePlan, installed []*cdn.Manifest) {
+	owned := make(map[string]bool)
+	for _, plan := range plans {
+		for name := range plan.remote.HashList {
+			owned[name] = true
+		}
+	}
+	for _, man := range installed {
+		for name := range man.HashList {
+			owned[name] = true
+		}
+	}
+
+	for _, plan := range plans {
+		if plan.local == nil {
+			continue
+		}
+
+		for name := range plan.local.HashList {
+			if !owned[name] {
+				plan.stale = append(plan.stale, name)
+			}
+		}
+
+		sort.Strings(plan.stale)
+		for _, name := range plan.stale {
+			plan.update.Files = append(plan.update.Files, &FileChange{Name: name, Change: FileRemoved, Size: plan.local.SizeList[name]})
+		}
+	}
+}
+
+// replacedExtractions returns the files extracted from archives the plan replaces or deletes, which the update does not extract again.
+// Files also extracted from an archive that is kept or listed in the remote manifest are kept, records of deleted archives are returned as well.
+func replacedExtractions(path, staged string, plan *modulePlan) ([]string, error) {
+	archives := make(map[string]bool)
+	for _, file := range plan.files {
+		if extract.Supported(file.Name) {
+			archives[file.Name] = true
+		}
+	}
+	for _, name := range plan.stale {
+		if extract.Supported(name) {
+			archives[name] = true
+		}
+	}
+	if len(archives) == 0 {
+		return nil, nil
+	}
+
+	exs, err := readExtractions(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read extracted files: %w", err)
+	}
+
+	kept := make(map[string]bool)
+	for name := range plan.remote.HashList {
+		kept[name] = true
+	}
+	for _, ex := range exs {
+		if archives[ex.Archive] {
+			continue
+		}
+		for _, file := range ex.Files {
+			kept[file.Name] = true
+		}
+	}
+
+	names := make([]string, 0)
+	for _, ex := range exs {
+		if !archives[ex.Archive] {
+			continue
+		}
+
+		files := make([]string, 0, len(ex.Files)+1)
+		for _, file := range ex.Files {
+			if !kept[file.Name] {
+				files = append(files, file.Name)
+			}
+		}
+		files = append(files, extractionRecord(ex.Archive))
+
+		for _, name := range files {
+			fpath, err := resolvePath(staged, name)
+			if err != nil {
+				return nil, err
+			}
+			// the update extracted the file again, the staged version replaces it
+			if _, err = os.Lstat(fpath); err == nil {
+				continue
+			}
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// repairModule returns the files to re-download for the failing files of the module.
+// Files can only be repaired if the cdn still serves the installed version of the module and of them,
+// files without checksum are compared by the version and build of the manifest and their size.
+func (u *updater) repairModule(ctx context.Context, path, mod string, failed []*FileReport) (*ModuleUpdate, []*cdn.File, error) {
+	c, ok := u.reg.moduleCDN(mod)
+	if !ok {
+		return nil, nil, newErrNoCDN(mod)
+	}
+
+	lman, err := readLocalManifest(path, mod)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, fmt.Errorf("unable to read local manifest for module %s: %w", mod, err)
+	}
+
+	rman, mfiles, err := c.Files(ctx, u.branch, u.arch, mod, false)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to gather files of module %s: %w", mod, err)
+	}
+	if lman != nil && (rman.Version != lman.Version || rman.BuildNumber != lman.BuildNumber) {
+		return nil, nil, fmt.Errorf("module %s can not be repaired, the cdn serves %s (build %d) but %s (build %d) is installed, consider updating", mod, rman.Version, rman.BuildNumber, lman.Version, lman.BuildNumber)
+	}
+
+	index := make(map[string]*cdn.File, len(mfiles))
+	for _, file := range mfiles {
+		index[file.Name] = file
+	}
+
+	upd := &ModuleUpdate{Module: mod}
+	if lman != nil {
+		upd.FromVersion = lman.Version
+		upd.ToVersion = lman.Version
+	}
+
+	files := make([]*cdn.File, 0, len(failed))
+	errs := make([]error, 0)
+	queued := make(map[string]bool, len(failed))
+	for _, f := range failed {
+		// extracted files are repaired by extracting their archive again
+		name := f.Name
+		if f.Archive != "" {
+			name = f.Archive
+		}
+		if queued[name] {
+			continue
+		}
+		queued[name] = true
+
+		file, ok := index[name]
+		if !ok || (lman != nil && (file.Hash != lman.HashList[name] || file.Size != lman.SizeList[name])) {
+			errs = append(errs, fmt.Errorf("file %s of module %s can not be repaired, the cdn serves a different version of it, consider updating", name, mod))
+			continue
+		}
+
+		if f.Archive != "" {
+			logging.InfoLogger.Printf("repairing %s (module %s): %s %s", name, mod, f.Name, f.State)
+		} else {
+			logging.InfoLogger.Printf("repairing %s (module %s): %s", name, mod, f.State)
+		}
+		files = append(files, file)
+		upd.Files = append(upd.Files, &FileChange{Name: name, Change: FileModified, Size: file.Size})
+	}
+
+	return upd, files, errors.Join(errs...)
+}
+
+func (u *updater) Repair(ctx context.Context, path string) (UpdateResult, Report, error) {
+	pending, err := recoverJournal(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	report, err := u.check.Report(ctx, path, true)
+	if err != nil && len(report) < 1 {
+		return nil, nil, err
+	} else if err != nil {
+		logging.WarnLogger.Printf("encountered errors while verifying: %v", err)
+	}
+
+	broken := make([]string, 0)
+	for _, mod := range report.Modules() {
+		if len(report[mod].Failed()) > 0 {
+			broken = append(broken, mod)
+		}
+	}
+
+	repairs := make([]*ModuleUpdate, len(broken))
+	repaired := make([][]*cdn.File, len(broken))
+	failed := make([]error, len(broken))
+	forEach(ctx, len(broken), u.opts.concurrency, func(i int) {
+		repairs[i], repaired[i], failed[i] = u.repairModule(ctx, path, broken[i], report[broken[i]].Failed())
+		if failed[i] != nil {
+			logging.WarnLogger.Printf(failed[i].Error())
+		}
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	result := make(UpdateResult, 0, len(broken))
+	files := make([]*cdn.File, 0)
+	errs := make([]error, 0)
+	for i, upd := range repairs {
+		if failed[i] != nil {
+			errs = append(errs, failed[i])
+		}
+		if upd != nil && len(upd.Files) > 0 {
+			result = append(result, upd)
+			files = append(files, repaired[i]...)
+		}
+	}
+
+	if len(files) > 0 {
+		tx, remaining, err := beginTransaction(path, "repair", files, pending)
+		if err != nil {
+			return result, nil, err
+		}
+
+		logging.InfoLogger.Printf("downloading %d broken files", len(remaining))
+		tracker := result.newTracker(remaining, tx.journal.done)
+		err = u.dl.downloadFiles(ctx, tx.dir, remaining, tracker.finish)
+		tracker.close()
+		if err != nil {
+			tx.abort(err)
+			return result, nil, err
+		}
+
+		if err = tx.commit(); err != nil {
+			return result, nil, err
+		}
+	}
+
+	report, err = u.check.Report(ctx, path, true)
+	if err != nil {
+		errs = append(errs, err)
+	}
 
-	return nil
+	return result, report, errors.Join(errs...)
 }
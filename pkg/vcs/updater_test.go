@@ -0,0 +1,176 @@
+package vcs
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/timo972/altv-cli/pkg/cdn"
+	"github.com/timo972/altv-cli/pkg/platform"
+	"github.com/timo972/altv-cli/pkg/version"
+)
+
+// barrierCDN only serves the files of a module once n requests are in flight at the same time.
+type barrierCDN struct {
+	*fakeCDN
+	wg sync.WaitGroup
+}
+
+func newBarrierCDN(cdn *fakeCDN, n int) *barrierCDN {
+	c := &barrierCDN{fakeCDN: cdn}
+	c.wg.Add(n)
+	return c
+}
+
+func (c *barrierCDN) Files(ctx context.Context, branch version.Branch, arch platform.Arch, module string, manifest bool) (*cdn.Manifest, []*cdn.File, error) {
+	c.wg.Done()
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return c.fakeCDN.Files(ctx, branch, arch, module, manifest)
+	case <-time.After(time.Second):
+		return nil, nil, errors.New("modules are not resolved concurrently")
+	}
+}
+
+func TestUpdatePlansConcurrently(t *testing.T) {
+	modules := []string{"server", "data-files", "js-module"}
+	remote := newBarrierCDN(&fakeCDN{
+		man:   &cdn.Manifest{Version: "16.0.1", HashList: map[string]string{"altv-server": "a1"}, SizeList: map[string]int{"altv-server": 10}},
+		files: []*cdn.File{{Name: "altv-server", Hash: "a1", Size: 10}},
+	}, len(modules))
+
+	u := NewUpdater("x64_linux", "release", modules, NewRegistry(remote), WithConcurrency(len(modules), 0))
+	result, err := u.Update(context.Background(), t.TempDir(), UpdateOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result) != len(modules) {
+		t.Fatalf("got %d modules, want %d", len(result), len(modules))
+	}
+	for i, mod := range result {
+		if mod.Module != modules[i] {
+			t.Errorf("module %d: got %s, want %s", i, mod.Module, modules[i])
+		}
+	}
+}
+
+func TestRepairModule(t *testing.T) {
+	local := &cdn.Manifest{
+		BuildNumber: 1234,
+		Version:     "16.0.1",
+		HashList:    map[string]string{"altv-server": "a1", "modules/go-module.so": ""},
+		SizeList:    map[string]int{"altv-server": 10, "modules/go-module.so": 20},
+	}
+
+	tests := []struct {
+		name    string
+		build   int
+		version string
+		file    *cdn.File
+		wantErr bool
+	}{
+		{"same version", 1234, "16.0.1", &cdn.File{Name: "altv-server", Hash: "a1", Size: 10}, false},
+		{"other version", 1234, "16.0.2", &cdn.File{Name: "altv-server", Hash: "a1", Size: 10}, true},
+		{"other build", 1235, "16.0.1", &cdn.File{Name: "altv-server", Hash: "a1", Size: 10}, true},
+		{"other hash", 1234, "16.0.1", &cdn.File{Name: "altv-server", Hash: "a2", Size: 10}, true},
+		{"no checksum", 1234, "16.0.1", &cdn.File{Name: "modules/go-module.so", Size: 20}, false},
+		{"no checksum and other size", 1234, "16.0.1", &cdn.File{Name: "modules/go-module.so", Size: 21}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := t.TempDir()
+			if err := writeLocalManifest(path, "server", local); err != nil {
+				t.Fatal(err)
+			}
+
+			remote := &fakeCDN{
+				man:   &cdn.Manifest{BuildNumber: tt.build, Version: tt.version},
+				files: []*cdn.File{tt.file},
+			}
+			u := NewUpdater("x64_linux", "release", nil, NewRegistry(remote)).(*updater)
+
+			failed := []*FileReport{{Name: tt.file.Name, State: FileHashMismatch}}
+			_, files, err := u.repairModule(context.Background(), path, "server", failed)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if repaired := len(files) == 1 && files[0] == tt.file; repaired == tt.wantErr {
+				t.Errorf("got files %v, want repaired %v", files, !tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUpdatePrune(t *testing.T) {
+	remote := testManifest("16.0.2", 1002, map[string]string{"altv-server": "server"})
+	installed := map[string]string{
+		"altv-server":          "server",
+		"data/removed.dat":     "removed",
+		"data/moved.dat":       "moved",
+		"server.toml":          "name = 'test'",
+		"resources/main.js":    "main",
+		"modules/js-module.so": "js",
+	}
+
+	tests := []struct {
+		name string
+		opts UpdateOptions
+		// removed are the files the update plans to delete, deleted the ones actually gone afterwards
+		removed []string
+		deleted []string
+	}{
+		{"prune", UpdateOptions{Prune: true}, []string{"data/removed.dat"}, []string{"data/removed.dat"}},
+		{"no prune", UpdateOptions{}, nil, nil},
+		{"dry run", UpdateOptions{Prune: true, DryRun: true}, []string{"data/removed.dat"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := t.TempDir()
+			writeTree(t, path, installed)
+			// data/moved.dat moved from the server to the js module, which is installed but not updated
+			local := testManifest("16.0.1", 1001, map[string]string{"altv-server": "server", "data/removed.dat": "removed", "data/moved.dat": "moved"})
+			if err := writeLocalManifest(path, "server", local); err != nil {
+				t.Fatal(err)
+			}
+			js := testManifest("1.0.0", 1, map[string]string{"modules/js-module.so": "js", "data/moved.dat": "moved"})
+			if err := writeLocalManifest(path, "js-module", js); err != nil {
+				t.Fatal(err)
+			}
+
+			u := NewUpdater("x64_linux", "release", []string{"server"}, NewRegistry(&fakeCDN{man: remote}))
+			result, err := u.Update(context.Background(), path, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var removed []string
+			for _, file := range result[0].Files {
+				if file.Change == FileRemoved {
+					removed = append(removed, file.Name)
+				}
+			}
+			if !slices.Equal(removed, tt.removed) {
+				t.Errorf("got removals %v, want %v", removed, tt.removed)
+			}
+
+			got := readInstallation(t, path)
+			for name, content := range installed {
+				if deleted := slices.Contains(tt.deleted, name); (got[name] != content) != deleted {
+					t.Errorf("file %s: got %q, want deleted %v", name, got[name], deleted)
+				}
+			}
+		})
+	}
+}